@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/glaslos/tlsh"
+	"github.com/glaslos/tlsh/cluster"
+)
+
+// clusterMember is a digest of a cluster
+type clusterMember struct {
+	ID     string `json:"id"`
+	Digest string `json:"digest"`
+	// Distance to the representative
+	Distance int `json:"distance"`
+}
+
+// clusterOutput is a cluster as printed by the cluster command
+type clusterOutput struct {
+	ID               int             `json:"id"`
+	Size             int             `json:"size"`
+	Representative   string          `json:"representative"`
+	RepresentativeID string          `json:"representative_id"`
+	Radius           int             `json:"radius"`
+	Members          []clusterMember `json:"members"`
+}
+
+// clusterCommand clusters the digests of a directory or digest list
+func clusterCommand(args []string) error {
+	var (
+		dir       string
+		list      string
+		algorithm string
+		indexKind string
+		threshold int
+		minPts    int
+		format    string
+	)
+	fs := flag.NewFlagSet("cluster", flag.ContinueOnError)
+	fs.StringVar(&dir, "d", "", "`directory` to hash recursively")
+	fs.StringVar(&list, "l", "", "digest list `file` with one digest and ID per line")
+	fs.StringVar(&algorithm, "algo", "components", "clustering `algorithm`, components or dbscan")
+	fs.StringVar(&indexKind, "index", "band", "neighbour `index`, band is fast but may miss links beyond distance 100, exact compares all pairs")
+	fs.IntVar(&threshold, "t", 100, "maximum `distance` of linked digests")
+	fs.IntVar(&minPts, "minpts", 3, "minimum `number` of digests within the threshold of a dbscan core digest")
+	fs.StringVar(&format, "format", "text", "output `format`, text, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (dir == "") == (list == "") {
+		fs.Usage()
+		return errors.New("need either a directory or a digest list")
+	}
+	if algorithm != "components" && algorithm != "dbscan" {
+		return fmt.Errorf("unknown algorithm %q", algorithm)
+	}
+	if indexKind != "band" && indexKind != "exact" {
+		return fmt.Errorf("unknown index %q", indexKind)
+	}
+	if format != "text" && format != "json" && format != "csv" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	var (
+		entries []entry
+		err     error
+	)
+	if dir != "" {
+		entries, err = hashDir(dir)
+	} else {
+		entries, err = readDigestList(list)
+	}
+	if err != nil {
+		return err
+	}
+	hashes := make([]*tlsh.TLSH, len(entries))
+	for i, e := range entries {
+		hashes[i] = e.Hash
+	}
+
+	var index cluster.NeighbourIndex
+	if indexKind == "exact" {
+		index, err = cluster.NewExactIndex(hashes)
+	} else {
+		index, err = cluster.NewBandIndex(hashes, tlsh.DefaultBandOptions)
+	}
+	if err != nil {
+		return err
+	}
+
+	var result cluster.Result
+	if algorithm == "dbscan" {
+		result, err = cluster.DBSCAN(hashes, threshold, minPts, index)
+	} else {
+		result, err = cluster.Components(hashes, threshold, index)
+	}
+	if err != nil {
+		return err
+	}
+
+	clusters := make([]clusterOutput, result.Clusters)
+	for c, members := range result.Members() {
+		clusterHashes := make([]*tlsh.TLSH, len(members))
+		for i, j := range members {
+			clusterHashes[i] = hashes[j]
+		}
+		medoid, err := cluster.Medoid(clusterHashes)
+		if err != nil {
+			return err
+		}
+		rep := entries[members[medoid]]
+		out := clusterOutput{ID: c, Size: len(members), Representative: rep.Hash.String(), RepresentativeID: rep.ID}
+		for _, j := range members {
+			d := rep.Hash.Diff(hashes[j])
+			if d > out.Radius {
+				out.Radius = d
+			}
+			out.Members = append(out.Members, clusterMember{ID: entries[j].ID, Digest: hashes[j].String(), Distance: d})
+		}
+		clusters[c] = out
+	}
+	noise := make([]clusterMember, len(result.Noise))
+	for i, j := range result.Noise {
+		noise[i] = clusterMember{ID: entries[j].ID, Digest: hashes[j].String()}
+	}
+
+	switch format {
+	case "text":
+		writeClustersText(os.Stdout, clusters, noise)
+		return nil
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Clusters []clusterOutput `json:"clusters"`
+			Noise    []clusterMember `json:"noise"`
+		}{clusters, noise})
+	}
+	return writeClustersCSV(os.Stdout, clusters, noise)
+}
+
+func writeClustersText(w io.Writer, clusters []clusterOutput, noise []clusterMember) {
+	for _, c := range clusters {
+		fmt.Fprintf(w, "cluster %d  size %d  radius %d  %s  %s\n", c.ID, c.Size, c.Radius, c.Representative, c.RepresentativeID)
+		for _, m := range c.Members {
+			fmt.Fprintf(w, "  %d  %s  %s\n", m.Distance, m.Digest, m.ID)
+		}
+	}
+	if len(noise) > 0 {
+		fmt.Fprintf(w, "noise  size %d\n", len(noise))
+		for _, m := range noise {
+			fmt.Fprintf(w, "  %s  %s\n", m.Digest, m.ID)
+		}
+	}
+}
+
+// writeClustersCSV writes one row per digest, noise in cluster -1
+func writeClustersCSV(w io.Writer, clusters []clusterOutput, noise []clusterMember) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"cluster", "size", "representative", "id", "digest", "distance"})
+	for _, c := range clusters {
+		for _, m := range c.Members {
+			cw.Write([]string{strconv.Itoa(c.ID), strconv.Itoa(c.Size), c.Representative, m.ID, m.Digest, strconv.Itoa(m.Distance)})
+		}
+	}
+	for _, m := range noise {
+		cw.Write([]string{strconv.Itoa(cluster.Noise), "1", "", m.ID, m.Digest, ""})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/glaslos/tlsh"
+	"github.com/glaslos/tlsh/db"
+)
+
+// dbCommand builds or queries a digest database
+func dbCommand(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "build":
+			return dbBuild(args[1:])
+		case "query":
+			return dbQuery(args[1:])
+		}
+	}
+	return errors.New("usage: tlsh db build|query [options]")
+}
+
+// dbBuild hashes all files in a directory into a digest database
+func dbBuild(args []string) error {
+	var (
+		dir      string
+		output   string
+		appendDB bool
+	)
+	fs := flag.NewFlagSet("db build", flag.ContinueOnError)
+	fs.StringVar(&dir, "d", "", "`directory` to hash recursively")
+	fs.StringVar(&output, "o", "", "digest database `file` to write")
+	fs.BoolVar(&appendDB, "a", false, "append to an existing database instead of replacing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if dir == "" || output == "" {
+		fs.Usage()
+		return errors.New("missing directory or database file")
+	}
+
+	open := db.Create
+	if appendDB {
+		open = db.Append
+	}
+	w, err := open(output)
+	if err != nil {
+		return err
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		hash, err := tlsh.HashFilename(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			return nil
+		}
+		return w.Write(db.Record{Hash: hash, ID: path})
+	})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// dbQuery prints the database records similar to a file
+func dbQuery(args []string) error {
+	var (
+		database  string
+		query     string
+		threshold int
+	)
+	fs := flag.NewFlagSet("db query", flag.ContinueOnError)
+	fs.StringVar(&database, "db", "", "digest database `file` to query")
+	fs.StringVar(&query, "f", "", "path to the `file` to look up")
+	fs.IntVar(&threshold, "t", 70, "maximum `distance` of matches")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if database == "" || query == "" {
+		fs.Usage()
+		return errors.New("missing database or query file")
+	}
+
+	hash, err := tlsh.HashFilename(query)
+	if err != nil {
+		return err
+	}
+	d, err := db.Open(database)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	for _, m := range d.Query(hash, threshold) {
+		fmt.Printf("%d  %s  %s\n", m.Distance, d.Hash(m.Index), d.Record(m.Index).ID)
+	}
+	return nil
+}
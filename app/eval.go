@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/glaslos/tlsh/evaluate"
+)
+
+// evalCommand evaluates distance thresholds on a labelled directory tree
+func evalCommand(args []string) error {
+	var (
+		dir        string
+		output     string
+		format     string
+		thresholds string
+		targetFPR  float64
+	)
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.StringVar(&dir, "d", "", "`directory` with one subdirectory per family")
+	fs.StringVar(&output, "o", "", "`file` to write the report to instead of stdout")
+	fs.StringVar(&format, "format", "json", "report `format`, json or csv")
+	fs.StringVar(&thresholds, "t", "30,50,70,100", "comma separated `thresholds` to report")
+	fs.Float64Var(&targetFPR, "fpr", 0.001, "target false positive `rate` for the best threshold")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if dir == "" {
+		fs.Usage()
+		return errors.New("missing directory")
+	}
+	var write func(*evaluate.Report, io.Writer) error
+	switch format {
+	case "json":
+		write = (*evaluate.Report).WriteJSON
+	case "csv":
+		write = (*evaluate.Report).WriteCSV
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	var ts []int
+	for _, s := range strings.Split(thresholds, ",") {
+		t, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("invalid threshold %q", s)
+		}
+		ts = append(ts, t)
+	}
+
+	c, err := evaluate.LoadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range c.Skipped {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", s.Path, s.Err)
+	}
+	r, err := evaluate.Evaluate(c, ts, targetFPR)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return write(r, os.Stdout)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := write(r, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
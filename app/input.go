@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glaslos/tlsh"
+)
+
+// entry is a digest with the path or ID it belongs to
+type entry struct {
+	ID   string
+	Hash *tlsh.TLSH
+}
+
+// hashDir hashes all files in a directory recursively. Files that cannot be
+// hashed are reported on stderr and skipped.
+func hashDir(dir string) ([]entry, error) {
+	var entries []entry
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		hash, err := tlsh.HashFilename(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			return nil
+		}
+		entries = append(entries, entry{ID: path, Hash: hash})
+		return nil
+	})
+	return entries, err
+}
+
+// readDigestList reads a digest list as printed by the CLI, one digest per
+// line followed by whitespace and its ID. Empty lines and lines starting
+// with # are skipped, digests without an ID are named by their line number.
+func readDigestList(filename string) ([]entry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []entry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		digest, id := text, fmt.Sprintf("%s:%d", filename, line)
+		if i := strings.IndexAny(text, " \t"); i >= 0 {
+			digest, id = text[:i], strings.TrimSpace(text[i:])
+		}
+		hash, err := tlsh.ParseStringToTlsh(digest)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, line, err)
+		}
+		entries = append(entries, entry{ID: id, Hash: hash})
+	}
+	return entries, scanner.Err()
+}
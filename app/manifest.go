@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/glaslos/tlsh"
+)
+
+// manifestHeader starts every manifest, followed by the column names
+const manifestHeader = "%%%% TLSH-MANIFEST-1.0"
+
+// Audit statuses of a file
+const (
+	statusUnchanged          = "unchanged"
+	statusModifiedSimilar    = "modified-similar"
+	statusModifiedDissimilar = "modified-dissimilar"
+	statusNew                = "new"
+	statusMissing            = "missing"
+	statusUnreadable         = "unreadable"
+)
+
+// Exit codes of the audit, errors exit with 1 like every command
+const (
+	exitSimilar = 2
+	exitDrift   = 3
+)
+
+// exitCode is returned by commands to exit with a code other than 1 without
+// printing an error
+type exitCode int
+
+func (e exitCode) Error() string {
+	return "exit status " + strconv.Itoa(int(e))
+}
+
+// manifestEntry is the record of a file in a manifest
+type manifestEntry struct {
+	Size   int64
+	SHA256 string
+	// Hash is nil for files that cannot be hashed, e.g. too small ones
+	Hash *tlsh.TLSH
+	Path string
+	// Err is set for files that could not be read, only Path is valid then
+	Err error
+}
+
+// manifestCommand writes or audits a manifest of a directory tree
+func manifestCommand(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "write":
+			return manifestWrite(args[1:])
+		case "audit":
+			return manifestAudit(args[1:])
+		}
+	}
+	return errors.New("usage: tlsh manifest write|audit [options]")
+}
+
+// scanTree records every regular file in dir by its slash separated path
+// relative to dir. Files and directories that cannot be read are recorded
+// with their error instead of stopping the scan.
+func scanTree(dir string) (map[string]manifestEntry, error) {
+	entries := map[string]manifestEntry{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil && path == dir {
+			return err
+		}
+		if err == nil && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, relErr := filepath.Rel(dir, path)
+		if relErr != nil {
+			return relErr
+		}
+		var e manifestEntry
+		if err == nil {
+			e, err = scanFile(path)
+		}
+		if err != nil {
+			e = manifestEntry{Err: err}
+		}
+		e.Path = filepath.ToSlash(rel)
+		entries[e.Path] = e
+		return nil
+	})
+	return entries, err
+}
+
+// scanFile reads a file once for its size, SHA-256 and TLSH
+func scanFile(path string) (manifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	defer f.Close()
+
+	r := &countingReader{r: f}
+	s := sha256.New()
+	hash, err := tlsh.HashReader(io.TeeReader(r, s))
+	if r.err != nil {
+		return manifestEntry{}, r.err
+	}
+	e := manifestEntry{Size: r.n, SHA256: hex.EncodeToString(s.Sum(nil))}
+	// files too small or too uniform to be hashed have no digest
+	if err == nil {
+		e.Hash = hash
+	}
+	return e, nil
+}
+
+// countingReader counts the bytes read and keeps the first read error, to
+// tell read errors from inputs that cannot be hashed
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// writeManifest writes the entries sorted by path, leaving out unreadable files
+func writeManifest(w io.Writer, entries map[string]manifestEntry) error {
+	paths := make([]string, 0, len(entries))
+	for p, e := range entries {
+		if e.Err == nil {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, manifestHeader)
+	fmt.Fprintln(bw, "%%%% size,sha256,tlsh,filename")
+	for _, p := range paths {
+		e := entries[p]
+		digest := ""
+		if e.Hash != nil {
+			digest = e.Hash.String()
+		}
+		fmt.Fprintf(bw, "%d,%s,%s,%s\n", e.Size, e.SHA256, digest, e.Path)
+	}
+	return bw.Flush()
+}
+
+// readManifest reads a manifest written by writeManifest. Lines starting
+// with ## are comments.
+func readManifest(r io.Reader) (map[string]manifestEntry, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || scanner.Text() != manifestHeader {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("not a tlsh manifest")
+	}
+	entries := map[string]manifestEntry{}
+	for line := 2; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "%%%%") || strings.HasPrefix(text, "##") {
+			continue
+		}
+		fields := strings.SplitN(text, ",", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("manifest line %d: expected 4 fields", line)
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("manifest line %d: %s", line, err)
+		}
+		e := manifestEntry{Size: size, SHA256: fields[1], Path: fields[3]}
+		if fields[2] != "" {
+			if e.Hash, err = tlsh.ParseStringToTlsh(fields[2]); err != nil {
+				return nil, fmt.Errorf("manifest line %d: %s", line, err)
+			}
+		}
+		entries[e.Path] = e
+	}
+	return entries, scanner.Err()
+}
+
+// manifestWrite records the files of a directory tree in a manifest
+func manifestWrite(args []string) error {
+	var dir, output string
+	fs := flag.NewFlagSet("manifest write", flag.ContinueOnError)
+	fs.StringVar(&dir, "d", "", "`directory` to record recursively")
+	fs.StringVar(&output, "o", "", "manifest `file` to write, stdout if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if dir == "" {
+		fs.Usage()
+		return errors.New("missing directory")
+	}
+	entries, err := scanTree(dir)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		err = writeManifest(os.Stdout, entries)
+	} else {
+		var f *os.File
+		if f, err = os.Create(output); err != nil {
+			return err
+		}
+		err = writeManifest(f, entries)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return unreadableError(entries)
+}
+
+// unreadableError reports the unreadable files on stderr and returns an
+// error if there are any
+func unreadableError(entries map[string]manifestEntry) error {
+	n := 0
+	for _, e := range entries {
+		if e.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", e.Path, e.Err)
+			n++
+		}
+	}
+	if n > 0 {
+		return fmt.Errorf("%d files could not be read and are not recorded", n)
+	}
+	return nil
+}
+
+// auditResult is the audit status of a file
+type auditResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	// Distance between the recorded and current digest of modified files,
+	// -1 if either cannot be hashed, nil for other files
+	Distance *int `json:"distance,omitempty"`
+	// Error of unreadable files
+	Error string `json:"error,omitempty"`
+}
+
+// audit compares the recorded and current entries, sorted by path
+func audit(recorded, current map[string]manifestEntry, threshold int) []auditResult {
+	var results []auditResult
+	for p, r := range recorded {
+		c, ok := current[p]
+		switch {
+		case !ok:
+			results = append(results, auditResult{Path: p, Status: statusMissing})
+		case c.Err != nil:
+			results = append(results, auditResult{Path: p, Status: statusUnreadable, Error: c.Err.Error()})
+		case r.Size == c.Size && r.SHA256 == c.SHA256:
+			results = append(results, auditResult{Path: p, Status: statusUnchanged})
+		case r.Hash == nil || c.Hash == nil:
+			d := -1
+			results = append(results, auditResult{Path: p, Status: statusModifiedDissimilar, Distance: &d})
+		default:
+			status := statusModifiedDissimilar
+			d := r.Hash.Diff(c.Hash)
+			if d <= threshold {
+				status = statusModifiedSimilar
+			}
+			results = append(results, auditResult{Path: p, Status: status, Distance: &d})
+		}
+	}
+	for p, c := range current {
+		if _, ok := recorded[p]; ok {
+			continue
+		}
+		if c.Err != nil {
+			results = append(results, auditResult{Path: p, Status: statusUnreadable, Error: c.Err.Error()})
+		} else {
+			results = append(results, auditResult{Path: p, Status: statusNew})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	return results
+}
+
+// manifestAudit compares a directory tree with a manifest. It exits with 0
+// if nothing changed, exitSimilar if all modified files are similar and
+// exitDrift for dissimilar, new, missing or unreadable files.
+func manifestAudit(args []string) error {
+	var (
+		dir       string
+		manifest  string
+		threshold int
+		format    string
+		verbose   bool
+	)
+	fs := flag.NewFlagSet("manifest audit", flag.ContinueOnError)
+	fs.StringVar(&dir, "d", "", "`directory` to audit recursively")
+	fs.StringVar(&manifest, "m", "", "manifest `file` to audit against")
+	fs.IntVar(&threshold, "t", 70, "maximum `distance` of similar modified files")
+	fs.StringVar(&format, "format", "text", "output `format`, text or json")
+	fs.BoolVar(&verbose, "v", false, "also list unchanged files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if dir == "" || manifest == "" {
+		fs.Usage()
+		return errors.New("missing directory or manifest")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	f, err := os.Open(manifest)
+	if err != nil {
+		return err
+	}
+	recorded, err := readManifest(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	current, err := scanTree(dir)
+	if err != nil {
+		return err
+	}
+	results := audit(recorded, current, threshold)
+
+	summary := map[string]int{}
+	for _, r := range results {
+		summary[r.Status]++
+	}
+	switch format {
+	case "text":
+		for _, r := range results {
+			switch {
+			case r.Status == statusUnchanged && !verbose:
+			case r.Status == statusModifiedSimilar || r.Status == statusModifiedDissimilar:
+				fmt.Printf("%s  %d  %s\n", r.Status, *r.Distance, r.Path)
+			case r.Status == statusUnreadable:
+				fmt.Printf("%s  %s  %s\n", r.Status, r.Path, r.Error)
+			default:
+				fmt.Printf("%s  %s\n", r.Status, r.Path)
+			}
+		}
+		fmt.Printf("%s %d, %s %d, %s %d, %s %d, %s %d, %s %d\n",
+			statusUnchanged, summary[statusUnchanged],
+			statusModifiedSimilar, summary[statusModifiedSimilar],
+			statusModifiedDissimilar, summary[statusModifiedDissimilar],
+			statusNew, summary[statusNew],
+			statusMissing, summary[statusMissing],
+			statusUnreadable, summary[statusUnreadable])
+	case "json":
+		if !verbose {
+			changed := results[:0]
+			for _, r := range results {
+				if r.Status != statusUnchanged {
+					changed = append(changed, r)
+				}
+			}
+			results = changed
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(struct {
+			Files   []auditResult  `json:"files"`
+			Summary map[string]int `json:"summary"`
+		}{results, summary})
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case summary[statusModifiedDissimilar]+summary[statusNew]+summary[statusMissing]+summary[statusUnreadable] > 0:
+		return exitCode(exitDrift)
+	case summary[statusModifiedSimilar] > 0:
+		return exitCode(exitSimilar)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/glaslos/tlsh"
+	"github.com/glaslos/tlsh/db"
+)
+
+// searchMatch is a reference digest within the threshold of a query
+type searchMatch struct {
+	ID       string `json:"id"`
+	Digest   string `json:"digest"`
+	Distance int    `json:"distance"`
+}
+
+// reference is a set of known digests to search
+type reference interface {
+	// Query returns the digests within threshold of t, sorted by distance
+	Query(t *tlsh.TLSH, threshold int) []searchMatch
+	Close() error
+}
+
+// dbReference searches a digest database
+type dbReference struct {
+	*db.DB
+}
+
+func (r dbReference) Query(t *tlsh.TLSH, threshold int) []searchMatch {
+	var matches []searchMatch
+	for _, m := range r.DB.Query(t, threshold) {
+		matches = append(matches, searchMatch{ID: r.Record(m.Index).ID, Digest: r.Hash(m.Index).String(), Distance: m.Distance})
+	}
+	return matches
+}
+
+// listReference searches digests held in memory
+type listReference struct {
+	entries []entry
+	hashes  []*tlsh.TLSH
+}
+
+func newListReference(entries []entry) *listReference {
+	r := &listReference{entries: entries, hashes: make([]*tlsh.TLSH, len(entries))}
+	for i, e := range entries {
+		r.hashes[i] = e.Hash
+	}
+	return r
+}
+
+func (r *listReference) Query(t *tlsh.TLSH, threshold int) []searchMatch {
+	var matches []searchMatch
+	for _, m := range tlsh.Search(t, r.hashes, 0, threshold) {
+		e := r.entries[m.Index]
+		matches = append(matches, searchMatch{ID: e.ID, Digest: e.Hash.String(), Distance: m.Distance})
+	}
+	return matches
+}
+
+func (r *listReference) Close() error {
+	return nil
+}
+
+// openReference opens a digest database, a CSV file ending in .csv with a
+// header row naming the ID and digest columns, or a digest list
+func openReference(filename, idColumn, digestColumn string) (reference, error) {
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		entries, err := readDigestCSV(filename, idColumn, digestColumn)
+		if err != nil {
+			return nil, err
+		}
+		return newListReference(entries), nil
+	}
+	d, err := db.Open(filename)
+	if err == nil {
+		return dbReference{d}, nil
+	}
+	if err != db.ErrFormat {
+		return nil, err
+	}
+	entries, err := readDigestList(filename)
+	if err != nil {
+		return nil, err
+	}
+	return newListReference(entries), nil
+}
+
+// readDigestCSV reads the ID and digest columns of a CSV file
+func readDigestCSV(filename, idColumn, digestColumn string) ([]entry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	idIndex, digestIndex := -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case idColumn:
+			idIndex = i
+		case digestColumn:
+			digestIndex = i
+		}
+	}
+	if idIndex < 0 || digestIndex < 0 {
+		return nil, fmt.Errorf("%s: missing column %q or %q", filename, idColumn, digestColumn)
+	}
+
+	var entries []entry
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		if idIndex >= len(record) || digestIndex >= len(record) {
+			return nil, fmt.Errorf("%s:%d: missing column", filename, line)
+		}
+		hash, err := tlsh.ParseStringToTlsh(strings.TrimSpace(record[digestIndex]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, line, err)
+		}
+		entries = append(entries, entry{ID: record[idIndex], Hash: hash})
+	}
+}
+
+// queryDigest hashes the file name or, if there is no such file, parses
+// name as a digest
+func queryDigest(name string) (*tlsh.TLSH, error) {
+	if _, err := os.Stat(name); err == nil {
+		return tlsh.HashFilename(name)
+	}
+	hash, err := tlsh.ParseStringToTlsh(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither a file nor a digest", name)
+	}
+	return hash, nil
+}
+
+// searchCommand lists the reference digests similar to a query
+func searchCommand(args []string) error {
+	var (
+		query        string
+		database     string
+		threshold    int
+		limit        int
+		format       string
+		idColumn     string
+		digestColumn string
+	)
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.StringVar(&query, "q", "", "query `file` or digest")
+	fs.StringVar(&database, "db", "", "reference `file`, a digest database, a CSV file or a digest list")
+	fs.IntVar(&threshold, "t", 70, "maximum `distance` of matches")
+	fs.IntVar(&limit, "k", 0, "maximum `number` of matches, 0 for all")
+	fs.StringVar(&format, "format", "text", "output `format`, text, json or csv")
+	fs.StringVar(&idColumn, "idcol", "id", "CSV `column` holding the IDs")
+	fs.StringVar(&digestColumn, "digestcol", "tlsh", "CSV `column` holding the digests")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if query == "" || database == "" {
+		fs.Usage()
+		return errors.New("missing query or reference file")
+	}
+	if format != "text" && format != "json" && format != "csv" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	hash, err := queryDigest(query)
+	if err != nil {
+		return err
+	}
+	ref, err := openReference(database, idColumn, digestColumn)
+	if err != nil {
+		return err
+	}
+	defer ref.Close()
+
+	matches := ref.Query(hash, threshold)
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	switch format {
+	case "text":
+		for _, m := range matches {
+			fmt.Printf("%d  %s  %s\n", m.Distance, m.Digest, m.ID)
+		}
+		return nil
+	case "json":
+		if matches == nil {
+			matches = []searchMatch{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(matches)
+	}
+	cw := csv.NewWriter(os.Stdout)
+	cw.Write([]string{"distance", "digest", "id"})
+	for _, m := range matches {
+		cw.Write([]string{strconv.Itoa(m.Distance), m.Digest, m.ID})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"image/png"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/glaslos/tlsh"
+	"github.com/glaslos/tlsh/archive"
 )
 
 var (
@@ -19,9 +23,21 @@ var (
 	file    string
 	compare string
 	raw     bool
+	members bool
+	img     string
 	version bool
 )
 
+// commands maps subcommand names to their implementation
+var commands = map[string]func(args []string) error{
+	"cluster":  clusterCommand,
+	"db":       dbCommand,
+	"eval":     evalCommand,
+	"manifest": manifestCommand,
+	"search":   searchCommand,
+	"watch":    watchCommand,
+}
+
 // Main contains the main code
 func Main() {
 	if version {
@@ -29,11 +45,15 @@ func Main() {
 		return
 	}
 	if file == "" {
-		fmt.Fprintf(os.Stderr, "Usage of %s [-f <file>]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage of %s [-f <file>] | cluster | db build|query | eval | manifest write|audit | search | watch\n\n", os.Args[0])
 		flag.PrintDefaults()
 		fmt.Println()
 		return
 	}
+	if members {
+		hashArchive()
+		return
+	}
 	hash, err := tlsh.HashFilename(file)
 	if err != nil {
 		fmt.Println(err)
@@ -46,9 +66,21 @@ func Main() {
 			return
 		}
 		distance := hash.Diff(hashCompare)
+		if img != "" {
+			if err := writeImage(img, hash, hashCompare); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
 
 		fmt.Printf("%d  %s  %s - %s  %s\n", distance, hash, file, hashCompare, compare)
 	} else {
+		if img != "" {
+			if err := writeImage(img, hash, nil); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
 		if raw {
 			fmt.Println(hash)
 		} else {
@@ -57,10 +89,72 @@ func Main() {
 	}
 }
 
+// imageCellSize is the size in pixels of a bucket in written images
+const imageCellSize = 16
+
+// writeImage writes the bucket grid of a, or the diff grid of a and b if b
+// is not nil, as SVG if filename ends in .svg and as PNG otherwise
+func writeImage(filename string, a, b *tlsh.TLSH) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(filename), ".svg") {
+		if b != nil {
+			err = tlsh.WriteDiffSVG(f, a, b, imageCellSize)
+		} else {
+			err = a.WriteSVG(f, imageCellSize)
+		}
+	} else {
+		if b != nil {
+			err = png.Encode(f, tlsh.DiffImage(a, b, imageCellSize))
+		} else {
+			err = png.Encode(f, a.Image(imageCellSize))
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// hashArchive prints the hash of every member of the archive
+func hashArchive() {
+	err := archive.WalkFilename(file, nil, func(m archive.Member) error {
+		path := file + archive.Separator + m.Path
+		switch {
+		case m.Err != nil:
+			fmt.Printf("%s: %s\n", path, m.Err)
+		case raw:
+			fmt.Println(m.Hash)
+		default:
+			fmt.Printf("%s  %s\n", m.Hash, path)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				if code, ok := err.(exitCode); ok {
+					os.Exit(int(code))
+				}
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	flag.StringVar(&file, "f", "", "path to the `file` to be hashed")
 	flag.StringVar(&compare, "c", "", "specifies a `filename` or `digest` whose TLSH value will be compared to a filename specified (-f)")
 	flag.BoolVar(&raw, "r", false, "set to get only the hash")
+	flag.BoolVar(&members, "a", false, "hash every member of the ZIP, tar or gzip archive (-f)")
+	flag.StringVar(&img, "img", "", "write the bucket grid of -f, or its diff with -c, to a PNG or SVG `file`")
 	flag.BoolVar(&version, "version", false, "print version")
 	flag.Parse()
 	Main()
@@ -1,6 +1,17 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestMainVersion(t *testing.T) {
 	version = true
@@ -55,3 +66,417 @@ func TestMainEntryPoint(t *testing.T) {
 	file = ""
 	main()
 }
+
+func TestMainArchive(t *testing.T) {
+	version = false
+	file = "../tests/test_file_1"
+	compare = ""
+	members = true
+	defer func() { members = false }()
+	Main()
+}
+
+func TestDBCommand(t *testing.T) {
+	database := filepath.Join(t.TempDir(), "test.tlshdb")
+	if err := dbCommand([]string{"build", "-d", "../tests", "-o", database}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbCommand([]string{"build", "-a", "-d", "../tests", "-o", database}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbCommand([]string{"query", "-db", database, "-f", "../tests/test_file_1", "-t", "100"}); err != nil {
+		t.Error(err)
+	}
+	if err := dbCommand([]string{"query", "-db", database, "-f", "../tests/NON_EXISTENT"}); err == nil {
+		t.Error("missing error for non existent query file")
+	}
+	if err := dbCommand([]string{"rebuild"}); err == nil {
+		t.Error("missing error for unknown db command")
+	}
+}
+
+func TestEvalCommand(t *testing.T) {
+	dir := t.TempDir()
+	for family, filename := range map[string]string{"text": "../tests/test_file_1", "exe": "../tests/test_file_9_tinyssl.exe"} {
+		blob, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Mkdir(filepath.Join(dir, family), 0755)
+		for i := 0; i < 2; i++ {
+			blob[i] ^= 0xff
+			if err := os.WriteFile(filepath.Join(dir, family, strconv.Itoa(i)), blob, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	report := filepath.Join(t.TempDir(), "report.csv")
+	if err := evalCommand([]string{"-d", dir, "-format", "csv", "-o", report}); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := os.ReadFile(report); err != nil || !bytes.HasPrefix(out, []byte("kind,threshold,")) {
+		t.Errorf("\nunexpected report %q (%v)\n", out, err)
+	}
+	if err := evalCommand([]string{"-d", dir, "-t", "30,x"}); err == nil {
+		t.Error("missing error for invalid threshold")
+	}
+	xml := filepath.Join(t.TempDir(), "report.xml")
+	if err := evalCommand([]string{"-d", "missing", "-format", "xml", "-o", xml}); err == nil || !strings.Contains(err.Error(), "format") {
+		t.Errorf("\nexpected unknown format error, got %v\n", err)
+	}
+	if _, err := os.Stat(xml); !os.IsNotExist(err) {
+		t.Error("report created for an unknown format")
+	}
+	if err := evalCommand([]string{"-d", "../tests"}); err == nil {
+		t.Error("missing error for a directory without families")
+	}
+}
+
+func TestMainImage(t *testing.T) {
+	version = false
+	file = "../tests/test_file_1"
+	raw = true
+	defer func() { img, compare, raw = "", "", false }()
+	for _, name := range []string{"hash.png", "hash.svg"} {
+		img = filepath.Join(t.TempDir(), name)
+		compare = ""
+		Main()
+		compare = "../tests/test_file_2"
+		Main()
+		if info, err := os.Stat(img); err != nil || info.Size() == 0 {
+			t.Errorf("\nmissing image %s (%v)\n", img, err)
+		}
+	}
+}
+
+func TestClusterCommand(t *testing.T) {
+	for _, format := range []string{"text", "json", "csv"} {
+		if err := clusterCommand([]string{"-d", "../tests", "-t", "200", "-format", format}); err != nil {
+			t.Error(err)
+		}
+	}
+	list := filepath.Join(t.TempDir(), "digests.txt")
+	digests := "# digests\n" +
+		"8ed02202fc30802303a002b03b33300fc30a82f83008c2fa000a0080b8ba0e02cca0c3\ttest_file_1\n\n" +
+		"b2319634f5c033244eb792aa3168a366e737553da305a28440ce842d7b57a2cc63b6ec\n"
+	if err := os.WriteFile(list, []byte(digests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readDigestList(list)
+	if err != nil || len(entries) != 2 || entries[0].ID != "test_file_1" || entries[1].ID != list+":4" {
+		t.Errorf("\nunexpected entries %+v (%v)\n", entries, err)
+	}
+	if err := clusterCommand([]string{"-l", list, "-algo", "dbscan", "-minpts", "1"}); err != nil {
+		t.Error(err)
+	}
+	if err := clusterCommand([]string{"-l", list, "-index", "exact", "-t", "300"}); err != nil {
+		t.Error(err)
+	}
+	// flags are checked before the missing directory is hashed
+	for _, flags := range [][]string{{"-index", "tree"}, {"-algo", "hac"}, {"-format", "xml"}} {
+		if err := clusterCommand(append([]string{"-d", "missing"}, flags...)); err == nil || !strings.Contains(err.Error(), "unknown") {
+			t.Errorf("\n%v: expected unknown flag value error, got %v\n", flags, err)
+		}
+	}
+	if err := clusterCommand([]string{"-l", list, "-d", "../tests"}); err == nil {
+		t.Error("missing error for directory and digest list")
+	}
+	if err := os.WriteFile(list, []byte("abcd\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := clusterCommand([]string{"-l", list}); err == nil {
+		t.Error("missing error for invalid digest")
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	dir := t.TempDir()
+	database := filepath.Join(dir, "known.tlshdb")
+	if err := dbCommand([]string{"build", "-d", "../tests", "-o", database}); err != nil {
+		t.Fatal(err)
+	}
+	digestCSV := filepath.Join(dir, "known.csv")
+	csvData := "name,tlsh,id\n" +
+		"one,8ed02202fc30802303a002b03b33300fc30a82f83008c2fa000a0080b8ba0e02cca0c3,test_file_1\n" +
+		"two,b2319634f5c033244eb792aa3168a366e737553da305a28440ce842d7b57a2cc63b6ec,test_file_2\n"
+	if err := os.WriteFile(digestCSV, []byte(csvData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list := filepath.Join(dir, "known.txt")
+	if err := os.WriteFile(list, []byte("8ed02202fc30802303a002b03b33300fc30a82f83008c2fa000a0080b8ba0e02cca0c3  test_file_1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range []string{database, digestCSV, list} {
+		for _, format := range []string{"text", "json", "csv"} {
+			if err := searchCommand([]string{"-q", "../tests/test_file_1", "-db", ref, "-t", "500", "-format", format}); err != nil {
+				t.Errorf("\n%s %s: %v\n", ref, format, err)
+			}
+		}
+	}
+	ref, err := openReference(digestCSV, "id", "tlsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, _ := queryDigest("b2319634f5c033244eb792aa3168a366e737553da305a28440ce842d7b57a2cc63b6ec")
+	if matches := ref.Query(query, 500); len(matches) != 2 || matches[0].ID != "test_file_2" || matches[1].Distance != 418 {
+		t.Errorf("\nunexpected matches %+v\n", matches)
+	}
+	if _, err := openReference(digestCSV, "sample", "tlsh"); err == nil {
+		t.Error("missing error for missing CSV column")
+	}
+
+	if err := searchCommand([]string{"-q", "../tests/NON_EXISTENT", "-db", database}); err == nil {
+		t.Error("missing error for invalid query")
+	}
+	if err := searchCommand([]string{"-q", "../tests/test_file_1", "-db", "../tests/NON_EXISTENT"}); err == nil {
+		t.Error("missing error for missing reference")
+	}
+	// the format is checked before the query is hashed and the reference opened
+	if err := searchCommand([]string{"-q", "../tests/NON_EXISTENT", "-db", "../tests/NON_EXISTENT", "-format", "xml"}); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("\nexpected unknown format error, got %v\n", err)
+	}
+	if err := searchCommand([]string{"-db", database}); err == nil {
+		t.Error("missing error for missing query")
+	}
+}
+
+func TestManifestCommand(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"test_file_2", "test_file_3", "test_file_5", "test_file_49bytes"} {
+		blob, err := os.ReadFile(filepath.Join("../tests", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), blob, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := filepath.Join(t.TempDir(), "manifest.txt")
+	if err := manifestCommand([]string{"write", "-d", dir, "-o", manifest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifestCommand([]string{"audit", "-d", dir, "-m", manifest, "-v"}); err != nil {
+		t.Errorf("\nexpected no drift, got %v\n", err)
+	}
+
+	// flip a few bytes for a similar modification
+	blob, _ := os.ReadFile(filepath.Join(dir, "test_file_3"))
+	blob[10], blob[100] = 'x', 'y'
+	os.WriteFile(filepath.Join(dir, "test_file_3"), blob, 0644)
+	if err := manifestCommand([]string{"audit", "-d", dir, "-m", manifest}); err != exitCode(exitSimilar) {
+		t.Errorf("\nexpected exit code %d, got %v\n", exitSimilar, err)
+	}
+
+	os.Remove(filepath.Join(dir, "test_file_2"))
+	blob, _ = os.ReadFile("../tests/test_file_1")
+	os.WriteFile(filepath.Join(dir, "test_file_1"), blob, 0644)
+	os.WriteFile(filepath.Join(dir, "test_file_49bytes"), blob[:40], 0644)
+	blob, _ = os.ReadFile("../tests/test_file_9_tinyssl.exe")
+	os.WriteFile(filepath.Join(dir, "test_file_5"), blob, 0644)
+	if err := manifestCommand([]string{"audit", "-d", dir, "-m", manifest, "-format", "json"}); err != exitCode(exitDrift) {
+		t.Errorf("\nexpected exit code %d, got %v\n", exitDrift, err)
+	}
+
+	f, err := os.Open(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := readManifest(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded["test_file_49bytes"].Hash != nil || recorded["test_file_2"].Hash == nil {
+		t.Errorf("\nunexpected manifest entries %+v\n", recorded)
+	}
+	current, err := scanTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"test_file_1":       statusNew,
+		"test_file_2":       statusMissing,
+		"test_file_3":       statusModifiedSimilar,
+		"test_file_49bytes": statusModifiedDissimilar,
+		"test_file_5":       statusModifiedDissimilar,
+	}
+	results := audit(recorded, current, 70)
+	if len(results) != len(expected) {
+		t.Fatalf("\nunexpected results %+v\n", results)
+	}
+	for _, r := range results {
+		if expected[r.Path] != r.Status {
+			t.Errorf("\n%s: expected %s, got %s\n", r.Path, expected[r.Path], r.Status)
+		}
+	}
+
+	// a modification leaving the digest unchanged keeps its distance of 0
+	modified := current["test_file_3"]
+	modified.SHA256 = strings.Repeat("0", 64)
+	results = audit(map[string]manifestEntry{"test_file_3": modified}, map[string]manifestEntry{"test_file_3": current["test_file_3"]}, 70)
+	if out, err := json.Marshal(results); err != nil || !strings.Contains(string(out), `"distance":0`) {
+		t.Errorf("\nexpected distance 0, got %s (%v)\n", out, err)
+	}
+
+	if _, err := readManifest(bytes.NewBufferString("size,sha256\n")); err == nil {
+		t.Error("missing error for invalid manifest")
+	}
+	if err := manifestCommand([]string{"audit", "-d", dir, "-m", manifest, "-format", "xml"}); err == nil || err == exitCode(exitDrift) {
+		t.Error("missing error for unknown format")
+	}
+	if err := manifestCommand([]string{"verify"}); err == nil {
+		t.Error("missing error for unknown manifest command")
+	}
+}
+
+func TestManifestUnreadable(t *testing.T) {
+	recorded := map[string]manifestEntry{"a": {Size: 1, SHA256: "00"}}
+	current := map[string]manifestEntry{
+		"a": {Path: "a", Err: os.ErrPermission},
+		"b": {Path: "b", Err: os.ErrPermission},
+	}
+	results := audit(recorded, current, 70)
+	if len(results) != 2 || results[0].Status != statusUnreadable || results[1].Status != statusUnreadable || results[0].Error == "" {
+		t.Errorf("\nunexpected results %+v\n", results)
+	}
+	var buf bytes.Buffer
+	if err := writeManifest(&buf, current); err != nil || strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("\nunreadable files should not be recorded: %q (%v)\n", buf.String(), err)
+	}
+
+	if os.Geteuid() == 0 || runtime.GOOS == "windows" {
+		t.Skip("permissions are not enforced")
+	}
+	dir := t.TempDir()
+	blob, err := os.ReadFile("../tests/test_file_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "readable"), blob, 0644)
+	os.WriteFile(filepath.Join(dir, "unreadable"), blob, 0)
+	entries, err := scanTree(dir)
+	if err != nil || entries["readable"].Hash == nil || entries["unreadable"].Err == nil {
+		t.Errorf("\nunexpected entries %+v (%v)\n", entries, err)
+	}
+	if err := manifestCommand([]string{"write", "-d", dir, "-o", filepath.Join(t.TempDir(), "manifest.txt")}); err == nil {
+		t.Error("missing error for an unreadable file")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	copyFile := func(src, dst string) {
+		blob, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, dst), blob, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copyFile("../tests/test_file_2", "existing")
+
+	entries, err := hashDir("../tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	w := newWatcher([]string{dir}, time.Second, newListReference(entries), 70, false, start)
+	if events := w.scan(start); len(events) != 0 {
+		t.Errorf("\nunexpected events for existing files %+v\n", events)
+	}
+
+	copyFile("../tests/test_file_1", "new")
+	copyFile("../tests/test_file_49bytes", "small")
+	if events := w.scan(start.Add(time.Second)); len(events) != 0 {
+		t.Errorf("\nunexpected events before files settled %+v\n", events)
+	}
+	events := w.scan(start.Add(2 * time.Second))
+	if len(events) != 2 {
+		t.Fatalf("\nexpected 2 events, got %+v\n", events)
+	}
+	for _, e := range events {
+		switch filepath.Base(e.Path) {
+		case "new":
+			if e.Event != "new" || e.Digest == "" || len(e.Matches) != 1 || e.Matches[0].Distance != 0 {
+				t.Errorf("\nunexpected event %+v\n", e)
+			}
+		case "small":
+			if e.Error == "" || e.Digest != "" {
+				t.Errorf("\nexpected error event, got %+v\n", e)
+			}
+		}
+	}
+	if events := w.scan(start.Add(3 * time.Second)); len(events) != 0 {
+		t.Errorf("\nunexpected repeated events %+v\n", events)
+	}
+
+	copyFile("../tests/test_file_3", "existing")
+	os.Chtimes(filepath.Join(dir, "existing"), start, start.Add(time.Minute))
+	os.Remove(filepath.Join(dir, "small"))
+	events = w.scan(start.Add(4 * time.Second))
+	if len(events) != 1 || events[0].Event != "removed" {
+		t.Errorf("\nexpected removed event, got %+v\n", events)
+	}
+	events = w.scan(start.Add(5 * time.Second))
+	if len(events) != 1 || events[0].Event != "changed" || len(events[0].Matches) != 1 {
+		t.Errorf("\nexpected changed event, got %+v\n", events)
+	}
+
+	// a known file changed and removed before settling is reported removed
+	copyFile("../tests/test_file_5", "existing")
+	os.Chtimes(filepath.Join(dir, "existing"), start, start.Add(2*time.Minute))
+	if events := w.scan(start.Add(6 * time.Second)); len(events) != 0 {
+		t.Errorf("\nunexpected events before the file settled %+v\n", events)
+	}
+	os.Remove(filepath.Join(dir, "existing"))
+	events = w.scan(start.Add(6500 * time.Millisecond))
+	if len(events) != 1 || events[0].Event != "removed" || filepath.Base(events[0].Path) != "existing" {
+		t.Errorf("\nexpected removed event, got %+v\n", events)
+	}
+
+	// an unreadable directory is reported once and its files are kept
+	moved := dir + ".moved"
+	if err := os.Rename(dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	events = w.scan(start.Add(7 * time.Second))
+	if len(events) != 1 || events[0].Event != "error" || events[0].Path != dir || events[0].Error == "" {
+		t.Errorf("\nexpected error event, got %+v\n", events)
+	}
+	if events := w.scan(start.Add(8 * time.Second)); len(events) != 0 {
+		t.Errorf("\nunexpected repeated events %+v\n", events)
+	}
+	if err := os.Rename(moved, dir); err != nil {
+		t.Fatal(err)
+	}
+	if events := w.scan(start.Add(9 * time.Second)); len(events) != 0 {
+		t.Errorf("\nunexpected events after the directory came back %+v\n", events)
+	}
+	copyFile("../tests/test_file_2", "existing")
+
+	// run reports files present at start with existing
+	var buf bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	w = newWatcher([]string{dir}, 0, nil, 70, true, time.Now())
+	if err := w.run(ctx, 10*time.Millisecond, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 || !strings.Contains(buf.String(), `"event":"new"`) {
+		t.Errorf("\nunexpected events:\n%s\n", buf.String())
+	}
+
+	if err := watchCommand([]string{"-d", dir, "-interval", "0s"}); err == nil {
+		t.Error("missing error for invalid interval")
+	}
+	if err := watchCommand([]string{}); err == nil {
+		t.Error("missing error for missing directory")
+	}
+	for _, d := range []string{filepath.Join(dir, "NON_EXISTENT"), filepath.Join(dir, "new")} {
+		if err := watchCommand([]string{"-d", dir + "," + d}); err == nil {
+			t.Errorf("\nmissing error for invalid directory %s\n", d)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glaslos/tlsh"
+)
+
+// watchEvent is printed as one JSON line for every settled file and for
+// every watched directory that became unreadable
+type watchEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Path  string    `json:"path"`
+	Size  int64     `json:"size,omitempty"`
+	// Digest is empty if the file could not be hashed, see Error
+	Digest  string        `json:"digest,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Matches []searchMatch `json:"matches,omitempty"`
+}
+
+// watchedFile is the last seen state of a file
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	// changed is when the size or modification time last changed
+	changed time.Time
+	// pending is the event to emit once the file settled, empty if the
+	// current state was already reported
+	pending string
+}
+
+// watcher polls directory trees for new or changed files
+type watcher struct {
+	dirs      []string
+	settle    time.Duration
+	ref       reference
+	threshold int
+	files     map[string]*watchedFile
+	// failed holds the watched directories that could not be read in the
+	// last scan
+	failed map[string]bool
+}
+
+// newWatcher returns a watcher. If existing is false, files present in the
+// first scan are not reported unless they change later.
+func newWatcher(dirs []string, settle time.Duration, ref reference, threshold int, existing bool, now time.Time) *watcher {
+	w := &watcher{dirs: dirs, settle: settle, ref: ref, threshold: threshold, files: map[string]*watchedFile{}, failed: map[string]bool{}}
+	if !existing {
+		w.walk(func(path string, info os.FileInfo) {
+			w.files[path] = &watchedFile{size: info.Size(), modTime: info.ModTime(), changed: now}
+		})
+	}
+	return w
+}
+
+// walk calls fn for every regular file of the watched directories and
+// returns the errors of the directories that could not be read. Other errors,
+// e.g. files removed while walking, are ignored until the next scan.
+func (w *watcher) walk(fn func(path string, info os.FileInfo)) map[string]error {
+	failed := map[string]error{}
+	for _, dir := range w.dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			switch {
+			case err != nil:
+				if path == dir {
+					failed[dir] = err
+				}
+			case path == dir && !info.IsDir():
+				failed[dir] = fmt.Errorf("%s is not a directory", dir)
+			case info.Mode().IsRegular():
+				fn(path, info)
+			}
+			return nil
+		})
+	}
+	return failed
+}
+
+// within reports whether path is in one of dirs
+func within(path string, dirs map[string]error) bool {
+	for dir := range dirs {
+		if strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan polls the directories once and returns the events of files that did
+// not change for the settle duration, of removed files and of directories
+// that became unreadable
+func (w *watcher) scan(now time.Time) []watchEvent {
+	var events []watchEvent
+	seen := map[string]bool{}
+	failed := w.walk(func(path string, info os.FileInfo) {
+		seen[path] = true
+		f, ok := w.files[path]
+		switch {
+		case !ok:
+			w.files[path] = &watchedFile{size: info.Size(), modTime: info.ModTime(), changed: now, pending: "new"}
+			return
+		case f.size != info.Size() || !f.modTime.Equal(info.ModTime()):
+			f.size, f.modTime, f.changed = info.Size(), info.ModTime(), now
+			if f.pending == "" {
+				f.pending = "changed"
+			}
+			return
+		}
+		if f.pending != "" && now.Sub(f.changed) >= w.settle {
+			events = append(events, w.hash(now, path, f))
+			f.pending = ""
+		}
+	})
+	for _, dir := range w.dirs {
+		err, ok := failed[dir]
+		if ok && !w.failed[dir] {
+			events = append(events, watchEvent{Time: now, Event: "error", Path: dir, Error: err.Error()})
+		}
+		w.failed[dir] = ok
+	}
+	for path, f := range w.files {
+		// files of unreadable directories are kept until they can be read again
+		if !seen[path] && !within(path, failed) {
+			delete(w.files, path)
+			// files never reported need no removal, known files do even
+			// if they changed after their last event
+			if f.pending != "new" {
+				events = append(events, watchEvent{Time: now, Event: "removed", Path: path})
+			}
+		}
+	}
+	return events
+}
+
+// hash hashes a settled file and looks it up in the reference set
+func (w *watcher) hash(now time.Time, path string, f *watchedFile) watchEvent {
+	e := watchEvent{Time: now, Event: f.pending, Path: path, Size: f.size}
+	hash, err := tlsh.HashFilename(path)
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	e.Digest = hash.String()
+	if w.ref != nil {
+		e.Matches = w.ref.Query(hash, w.threshold)
+	}
+	return e
+}
+
+// run polls every interval and writes the events as NDJSON until ctx is done
+func (w *watcher) run(ctx context.Context, interval time.Duration, out io.Writer) error {
+	enc := json.NewEncoder(out)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			for _, e := range w.scan(now) {
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// watchCommand reports new or changed files of directories as NDJSON events
+func watchCommand(args []string) error {
+	var (
+		dirs         string
+		database     string
+		threshold    int
+		interval     time.Duration
+		settle       time.Duration
+		existing     bool
+		idColumn     string
+		digestColumn string
+	)
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.StringVar(&dirs, "d", "", "comma separated `directories` to watch recursively")
+	fs.StringVar(&database, "db", "", "reference `file` to match files against, a digest database, a CSV file or a digest list")
+	fs.IntVar(&threshold, "t", 70, "maximum `distance` of matches")
+	fs.DurationVar(&interval, "interval", 2*time.Second, "polling `interval`")
+	fs.DurationVar(&settle, "settle", 5*time.Second, "`duration` a file must stay unchanged before it is hashed")
+	fs.BoolVar(&existing, "existing", false, "also report files present at start")
+	fs.StringVar(&idColumn, "idcol", "id", "CSV `column` holding the IDs")
+	fs.StringVar(&digestColumn, "digestcol", "tlsh", "CSV `column` holding the digests")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if dirs == "" {
+		fs.Usage()
+		return errors.New("missing directory")
+	}
+	if interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	roots := strings.Split(dirs, ",")
+	for _, dir := range roots {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+
+	var ref reference
+	if database != "" {
+		var err error
+		if ref, err = openReference(database, idColumn, digestColumn); err != nil {
+			return err
+		}
+		defer ref.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	w := newWatcher(roots, settle, ref, threshold, existing, time.Now())
+	return w.run(ctx, interval, os.Stdout)
+}
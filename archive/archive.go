@@ -0,0 +1,368 @@
+// Package archive calculates TLSH digests for the members of ZIP, tar and
+// gzip archives.
+//
+// Compression destroys the locality TLSH relies on, so hashing an archive as
+// a whole says little about its content. Walk decompresses the archive,
+// descends into nested archives up to a configurable depth and hashes every
+// regular file it finds. All decompressed data is counted against limits to
+// defend against decompression bombs.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/glaslos/tlsh"
+)
+
+// Separator joins the paths of nested archive members
+const Separator = "!"
+
+const (
+	peekSize     = 512
+	tarMagicOff  = 257
+	tarMagicSize = 5
+)
+
+var (
+	// ErrNotArchive is returned when the input is not a supported archive
+	ErrNotArchive = errors.New("not a supported archive")
+	// ErrMemberTooLarge is set on members exceeding Options.MaxMemberSize
+	ErrMemberTooLarge = errors.New("archive member exceeds size limit")
+	// ErrTotalTooLarge is returned when the decompressed data exceeds Options.MaxTotalSize
+	ErrTotalTooLarge = errors.New("archive exceeds total size limit")
+)
+
+// Options limits how deep and how much of an archive is decompressed
+type Options struct {
+	// MaxDepth is the number of nested archive levels to descend into,
+	// nested archives beyond it are hashed as regular members. A gzip
+	// compressed tar counts as a single level.
+	MaxDepth int
+	// MaxMemberSize is the maximum number of decompressed bytes per member,
+	// zero or less uses the default
+	MaxMemberSize int64
+	// MaxTotalSize is the maximum number of decompressed bytes per archive,
+	// zero or less uses the default
+	MaxTotalSize int64
+}
+
+// DefaultOptions are used when no options are passed
+var DefaultOptions = Options{
+	MaxDepth:      4,
+	MaxMemberSize: 256 << 20,
+	MaxTotalSize:  1 << 30,
+}
+
+// Member holds the digest of a single archive member
+type Member struct {
+	// Path of the member inside the archive, nested archives are joined with Separator
+	Path string
+	// Size is the number of decompressed bytes read
+	Size int64
+	// Hash is nil if the member could not be hashed, see Err
+	Hash *tlsh.TLSH
+	// Err is set if the member could not be hashed
+	Err error
+}
+
+// WalkFunc is called for every member, returning an error stops the walk
+type WalkFunc func(m Member) error
+
+type walker struct {
+	opts  Options
+	total int64
+	fn    WalkFunc
+	// stopped is the error of fn that stopped the walk
+	stopped error
+}
+
+// Walk calls fn for every regular file in the archive read from r
+func Walk(r io.Reader, opts *Options, fn WalkFunc) error {
+	w := newWalker(opts, fn)
+	br := bufio.NewReaderSize(r, peekSize)
+	kind := detect(br)
+	if kind == kindNone {
+		return ErrNotArchive
+	}
+	if kind == kindZip {
+		blob, err := w.readAll(br)
+		if err != nil {
+			return err
+		}
+		return w.zip(bytes.NewReader(blob), int64(len(blob)), "", 0)
+	}
+	return w.archive(kind, br, "", "", 0)
+}
+
+// WalkFilename calls fn for every regular file in the archive filename
+func WalkFilename(filename string, opts *Options, fn WalkFunc) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, peekSize)
+	kind := detect(br)
+	if kind != kindZip {
+		if kind == kindNone {
+			return ErrNotArchive
+		}
+		return newWalker(opts, fn).archive(kind, br, "", filepath.Base(filename), 0)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return newWalker(opts, fn).zip(f, fi.Size(), "", 0)
+}
+
+// HashFilename returns the digests of all regular files in the archive filename
+func HashFilename(filename string, opts *Options) ([]Member, error) {
+	var members []Member
+	err := WalkFilename(filename, opts, func(m Member) error {
+		members = append(members, m)
+		return nil
+	})
+	return members, err
+}
+
+func newWalker(opts *Options, fn WalkFunc) *walker {
+	w := &walker{opts: DefaultOptions, fn: fn}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.MaxMemberSize <= 0 {
+		w.opts.MaxMemberSize = DefaultOptions.MaxMemberSize
+	}
+	if w.opts.MaxTotalSize <= 0 {
+		w.opts.MaxTotalSize = DefaultOptions.MaxTotalSize
+	}
+	return w
+}
+
+type kind int
+
+const (
+	kindNone kind = iota
+	kindZip
+	kindTar
+	kindGzip
+)
+
+func detect(br *bufio.Reader) kind {
+	magic, _ := br.Peek(tarMagicOff + tarMagicSize)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return kindZip
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return kindGzip
+	case len(magic) == tarMagicOff+tarMagicSize && string(magic[tarMagicOff:]) == "ustar":
+		return kindTar
+	}
+	return kindNone
+}
+
+// archive walks a streamed tar or gzip archive, name is the archive's own
+// file name used to name the content of gzip streams without a header name
+func (w *walker) archive(k kind, r io.Reader, prefix, name string, depth int) error {
+	switch k {
+	case kindTar:
+		return w.tar(r, prefix, depth)
+	case kindGzip:
+		return w.gzip(r, prefix, name, depth)
+	}
+	return ErrNotArchive
+}
+
+func (w *walker) tar(r io.Reader, prefix string, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err := w.member(tr, join(prefix, hdr.Name), depth); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *walker) gzip(r io.Reader, prefix, name string, depth int) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	// a compressed tar is a single archive level, its members are not
+	// nested in a path component of the decompressed stream
+	br := bufio.NewReaderSize(w.limit(zr), peekSize)
+	if detect(br) == kindTar {
+		return w.tar(br, prefix, depth)
+	}
+	inner := zr.Name
+	if inner == "" {
+		inner = gzipContentName(path.Base(name))
+	}
+	return w.member(br, join(prefix, inner), depth)
+}
+
+// gzipContentName guesses the name of the compressed file from the name of the gzip file
+func gzipContentName(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".tgz"):
+		return strings.TrimSuffix(name, ".tgz") + ".tar"
+	case strings.HasSuffix(name, ".gz") && len(name) > len(".gz"):
+		return strings.TrimSuffix(name, ".gz")
+	case name == "" || name == "." || name == "/":
+		return "data"
+	}
+	return name
+}
+
+func (w *walker) zip(r io.ReaderAt, size int64, prefix string, depth int) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		p := join(prefix, f.Name)
+		if f.UncompressedSize64 > uint64(w.opts.MaxMemberSize) {
+			if err := w.emit(Member{Path: p, Err: ErrMemberTooLarge}); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			if err := w.emit(Member{Path: p, Err: err}); err != nil {
+				return err
+			}
+			continue
+		}
+		err = w.member(w.limit(rc), p, depth)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// member hashes a single member or descends into it if it is an archive
+func (w *walker) member(r io.Reader, name string, depth int) error {
+	br := bufio.NewReaderSize(r, peekSize)
+	if depth < w.opts.MaxDepth {
+		switch k := detect(br); k {
+		case kindZip:
+			blob, err := w.readAll(br)
+			if err == ErrMemberTooLarge {
+				return w.emit(Member{Path: name, Err: err})
+			}
+			if err != nil {
+				return err
+			}
+			return w.nested(name, w.zip(bytes.NewReader(blob), int64(len(blob)), name+Separator, depth+1))
+		case kindTar, kindGzip:
+			return w.nested(name, w.archive(k, br, name+Separator, name, depth+1))
+		}
+	}
+
+	lr := &limitReader{r: br, n: w.opts.MaxMemberSize, err: ErrMemberTooLarge}
+	t, err := tlsh.HashReader(lr)
+	if err == ErrTotalTooLarge {
+		return err
+	}
+	m := Member{Path: name, Size: w.opts.MaxMemberSize - lr.n, Err: err}
+	if err == nil {
+		m.Hash = t
+	}
+	return w.emit(m)
+}
+
+// emit calls fn and remembers the error stopping the walk
+func (w *walker) emit(m Member) error {
+	if err := w.fn(m); err != nil {
+		w.stopped = err
+		return err
+	}
+	return nil
+}
+
+// nested sets the error of a nested archive that could not be walked on its
+// member and continues the walk, unless the error stops it
+func (w *walker) nested(name string, err error) error {
+	if err == nil || err == ErrTotalTooLarge || err == w.stopped {
+		return err
+	}
+	return w.emit(Member{Path: name, Err: err})
+}
+
+// readAll reads a member that needs random access into memory
+func (w *walker) readAll(r io.Reader) ([]byte, error) {
+	return io.ReadAll(&limitReader{r: r, n: w.opts.MaxMemberSize, err: ErrMemberTooLarge})
+}
+
+// limit counts decompressed bytes against the total size limit
+func (w *walker) limit(r io.Reader) io.Reader {
+	return &totalReader{r: r, w: w}
+}
+
+type totalReader struct {
+	r io.Reader
+	w *walker
+}
+
+func (t *totalReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.w.total += int64(n)
+	if t.w.total > t.w.opts.MaxTotalSize {
+		return n, ErrTotalTooLarge
+	}
+	return n, err
+}
+
+// limitReader is an io.LimitedReader returning err once more than n bytes are read
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		l.n = 0
+		return n, l.err
+	}
+	l.n -= int64(n)
+	return n, err
+}
+
+func join(prefix, name string) string {
+	return prefix + strings.TrimPrefix(name, "/")
+}
@@ -0,0 +1,252 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	hash1 = "8ed02202fc30802303a002b03b33300fc30a82f83008c2fa000a0080b8ba0e02cca0c3"
+	hash2 = "b2319634f5c033244eb792aa3168a366e737553da305a28440ce842d7b57a2cc63b6ec"
+)
+
+func readFile(t *testing.T, filename string) []byte {
+	blob, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func zipBlob(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, blob := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(blob)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzBlob(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, blob := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(blob))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(blob)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func walk(t *testing.T, blob []byte, opts *Options) (map[string]Member, error) {
+	members := map[string]Member{}
+	err := Walk(bytes.NewReader(blob), opts, func(m Member) error {
+		members[m.Path] = m
+		return nil
+	})
+	return members, err
+}
+
+func TestWalkNested(t *testing.T) {
+	file1 := readFile(t, "../tests/test_file_1")
+	file2 := readFile(t, "../tests/test_file_2")
+	inner := tarGzBlob(t, map[string][]byte{"b/file2": file2})
+	outer := zipBlob(t, map[string][]byte{"a/file1": file1, "a/inner.tar.gz": inner})
+
+	members, err := walk(t, outer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memberTestCases := []struct {
+		path string
+		hash string
+		size int
+	}{
+		{"a/file1", hash1, len(file1)},
+		{"a/inner.tar.gz!b/file2", hash2, len(file2)},
+	}
+	if len(members) != len(memberTestCases) {
+		t.Errorf("\nexpected %d members, got %v\n", len(memberTestCases), members)
+	}
+	for _, tc := range memberTestCases {
+		m, ok := members[tc.path]
+		if !ok {
+			t.Errorf("\nmember %s missing\n", tc.path)
+			continue
+		}
+		if m.Err != nil {
+			t.Error(m.Err)
+			continue
+		}
+		if m.Hash.String() != tc.hash || m.Size != int64(tc.size) {
+			t.Errorf("\nmember %s: %s (%d bytes) vs. %s (%d bytes)\n", tc.path, m.Hash, m.Size, tc.hash, tc.size)
+		}
+	}
+}
+
+func TestWalkBrokenNested(t *testing.T) {
+	file1 := readFile(t, "../tests/test_file_1")
+	file2 := readFile(t, "../tests/test_file_2")
+	brokenTestCases := []struct {
+		name string
+		blob []byte
+	}{
+		{"bad.gz", append([]byte{0x1f, 0x8b, 0x00}, file1...)},
+		{"bad.tar", append(append(make([]byte, tarMagicOff), "ustar"...), file1...)},
+	}
+	for _, tc := range brokenTestCases {
+		// members in order, the broken one between two good ones
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, m := range []struct {
+			name string
+			blob []byte
+		}{{"good", file1}, {tc.name, tc.blob}, {"good2", file2}} {
+			w, err := zw.Create(m.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(m.blob)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		members, err := walk(t, buf.Bytes(), nil)
+		if err != nil {
+			t.Fatalf("\n%s: %v\n", tc.name, err)
+		}
+		if members["good"].Hash == nil || members["good2"].Hash == nil || members[tc.name].Err == nil {
+			t.Errorf("\n%s: unexpected members %v\n", tc.name, members)
+		}
+	}
+}
+
+func TestWalkMaxDepth(t *testing.T) {
+	file2 := readFile(t, "../tests/test_file_2")
+	inner := tarGzBlob(t, map[string][]byte{"file2": file2})
+	outer := zipBlob(t, map[string][]byte{"inner.tar.gz": inner})
+
+	members, err := walk(t, outer, &Options{MaxDepth: 0, MaxMemberSize: 1 << 20, MaxTotalSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := members["inner.tar.gz"]; !ok || m.Err != nil || m.Hash == nil {
+		t.Errorf("\nnested archive should be hashed as a member: %v\n", members)
+	}
+}
+
+func TestWalkDepth(t *testing.T) {
+	file2 := readFile(t, "../tests/test_file_2")
+	inner := zipBlob(t, map[string][]byte{"file2": file2})
+
+	outerTestCases := []struct {
+		name  string
+		outer []byte
+	}{
+		{"zip", zipBlob(t, map[string][]byte{"inner.zip": inner})},
+		{"tgz", tarGzBlob(t, map[string][]byte{"inner.zip": inner})},
+	}
+	for _, tc := range outerTestCases {
+		// zero size limits use the defaults
+		members, err := walk(t, tc.outer, &Options{MaxDepth: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m, ok := members["inner.zip!file2"]; !ok || m.Err != nil || m.Hash.String() != hash2 {
+			t.Errorf("\n%s: nested zip should be opened at depth 1: %v\n", tc.name, members)
+		}
+	}
+}
+
+func TestWalkLimits(t *testing.T) {
+	file1 := readFile(t, "../tests/test_file_1")
+	bomb := bytes.Repeat(file1, 64)
+	blob := zipBlob(t, map[string][]byte{"bomb": bomb})
+
+	members, err := walk(t, blob, &Options{MaxDepth: 1, MaxMemberSize: int64(len(file1)), MaxTotalSize: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if members["bomb"].Err != ErrMemberTooLarge {
+		t.Errorf("\nexpected %v, got %v\n", ErrMemberTooLarge, members["bomb"].Err)
+	}
+
+	gz := tarGzBlob(t, map[string][]byte{"bomb": bomb})
+	members, err = walk(t, gz, &Options{MaxDepth: 1, MaxMemberSize: int64(len(file1)), MaxTotalSize: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if members["bomb"].Err != ErrMemberTooLarge {
+		t.Errorf("\nexpected %v, got %v\n", ErrMemberTooLarge, members)
+	}
+
+	_, err = walk(t, gz, &Options{MaxDepth: 1, MaxMemberSize: 1 << 30, MaxTotalSize: int64(len(file1))})
+	if err != ErrTotalTooLarge {
+		t.Errorf("\nexpected %v, got %v\n", ErrTotalTooLarge, err)
+	}
+
+	// non-positive limits use the defaults
+	for _, size := range []int64{-1, -5} {
+		members, err = walk(t, blob, &Options{MaxDepth: 1, MaxMemberSize: size, MaxTotalSize: size})
+		if err != nil || members["bomb"].Err != nil || members["bomb"].Hash == nil {
+			t.Errorf("\nlimit %d: unexpected members %v (%v)\n", size, members, err)
+		}
+	}
+}
+
+func TestWalkFilename(t *testing.T) {
+	file1 := readFile(t, "../tests/test_file_1")
+	dir := t.TempDir()
+
+	archiveTestCases := []struct {
+		filename string
+		blob     []byte
+		path     string
+	}{
+		{"sample.zip", zipBlob(t, map[string][]byte{"file1": file1}), "file1"},
+		{"sample.tgz", tarGzBlob(t, map[string][]byte{"file1": file1}), "file1"},
+	}
+	for _, tc := range archiveTestCases {
+		filename := filepath.Join(dir, tc.filename)
+		if err := os.WriteFile(filename, tc.blob, 0644); err != nil {
+			t.Fatal(err)
+		}
+		members, err := HashFilename(filename, nil)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if len(members) != 1 || members[0].Path != tc.path || members[0].Hash.String() != hash1 {
+			t.Errorf("\n%s: unexpected members %v\n", tc.filename, members)
+		}
+	}
+
+	if _, err := HashFilename("../tests/test_file_1", nil); err != ErrNotArchive {
+		t.Errorf("\nexpected %v, got %v\n", ErrNotArchive, err)
+	}
+	if err := Walk(io.LimitReader(bytes.NewReader(file1), 10), nil, nil); err != ErrNotArchive {
+		t.Errorf("\nexpected %v, got %v\n", ErrNotArchive, err)
+	}
+}
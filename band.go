@@ -0,0 +1,212 @@
+package tlsh
+
+import (
+	"errors"
+	"sort"
+)
+
+// Match is a digest within the distance threshold of a query
+type Match struct {
+	// Index of the digest in the searched collection
+	Index int
+	// Distance to the query digest
+	Distance int
+}
+
+// BandOptions configures a BandIndex
+type BandOptions struct {
+	// Bands is the number of bands the code body is split into, between 1
+	// and 32. More bands find more distant matches at the cost of more
+	// candidates.
+	Bands int
+	// LengthBucket is the width of the lValue buckets, digests are only
+	// candidates if their lValues fall into the same or adjacent buckets.
+	// Zero disables length bucketing.
+	LengthBucket int
+	// QRatioBucket is the width of the q1Ratio and q2Ratio buckets, zero
+	// disables quartile ratio bucketing.
+	QRatioBucket int
+}
+
+// DefaultBandOptions finds most matches within a distance of about 100
+var DefaultBandOptions = BandOptions{
+	Bands:        16,
+	LengthBucket: 8,
+}
+
+// BandIndex finds candidate matches by locality sensitive hashing. The code
+// body is split into bands and digests sharing any band, within the same
+// header buckets, are verified with Diff.
+type BandIndex struct {
+	opts    BandOptions
+	hashes  []*TLSH
+	buckets map[uint64][]int
+}
+
+// NewBandIndex returns an empty index
+func NewBandIndex(opts BandOptions) (*BandIndex, error) {
+	if opts.Bands < 1 || opts.Bands > codeSize {
+		return nil, errors.New("bands must be between 1 and 32")
+	}
+	if opts.LengthBucket < 0 || opts.QRatioBucket < 0 {
+		return nil, errors.New("bucket widths must not be negative")
+	}
+	return &BandIndex{
+		opts:    opts,
+		buckets: map[uint64][]int{},
+	}, nil
+}
+
+// Add adds a digest to the index and returns its index
+func (b *BandIndex) Add(t *TLSH) int {
+	i := len(b.hashes)
+	b.hashes = append(b.hashes, t)
+	l, q1, q2 := b.header(t)
+	for band := 0; band < b.opts.Bands; band++ {
+		key := b.key(t, band, l, q1, q2)
+		b.buckets[key] = append(b.buckets[key], i)
+	}
+	return i
+}
+
+// Len returns the number of digests in the index
+func (b *BandIndex) Len() int {
+	return len(b.hashes)
+}
+
+// Hash returns the digest at index i
+func (b *BandIndex) Hash(i int) *TLSH {
+	return b.hashes[i]
+}
+
+// Candidates returns the sorted indices of digests sharing a band with t
+func (b *BandIndex) Candidates(t *TLSH) []int {
+	seen := map[int]bool{}
+	var candidates []int
+	l, q1, q2 := b.header(t)
+	for _, ll := range neighbours(l, 256, b.opts.LengthBucket) {
+		for _, qq1 := range neighbours(q1, 16, b.opts.QRatioBucket) {
+			for _, qq2 := range neighbours(q2, 16, b.opts.QRatioBucket) {
+				for band := 0; band < b.opts.Bands; band++ {
+					for _, i := range b.buckets[b.key(t, band, ll, qq1, qq2)] {
+						if !seen[i] {
+							seen[i] = true
+							candidates = append(candidates, i)
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.Ints(candidates)
+	return candidates
+}
+
+// Query returns the candidates within threshold of t, sorted by distance
+func (b *BandIndex) Query(t *TLSH, threshold int) []Match {
+	var matches []Match
+	for _, i := range b.Candidates(t) {
+		if d := t.Diff(b.hashes[i]); d <= threshold {
+			matches = append(matches, Match{Index: i, Distance: d})
+		}
+	}
+	SortMatches(matches)
+	return matches
+}
+
+// BandEvaluation compares a BandIndex with a brute-force scan
+type BandEvaluation struct {
+	// Queries is the number of query digests
+	Queries int
+	// Expected is the number of matches found by the brute-force scan
+	Expected int
+	// Found is the number of matches found by the index
+	Found int
+	// Recall is Found divided by Expected, 1 if nothing was expected
+	Recall float64
+	// Candidates is the number of candidates verified with Diff
+	Candidates int
+	// CandidateRatio is the fraction of the index verified per query
+	CandidateRatio float64
+}
+
+// Evaluate reports the recall of the index for the queries and threshold
+// compared to a brute-force scan of all digests in the index
+func (b *BandIndex) Evaluate(queries []*TLSH, threshold int) BandEvaluation {
+	e := BandEvaluation{Queries: len(queries)}
+	for _, q := range queries {
+		for _, h := range b.hashes {
+			if q.Diff(h) <= threshold {
+				e.Expected++
+			}
+		}
+		e.Found += len(b.Query(q, threshold))
+		e.Candidates += len(b.Candidates(q))
+	}
+	e.Recall = 1
+	if e.Expected > 0 {
+		e.Recall = float64(e.Found) / float64(e.Expected)
+	}
+	if len(queries) > 0 && len(b.hashes) > 0 {
+		e.CandidateRatio = float64(e.Candidates) / float64(len(queries)*len(b.hashes))
+	}
+	return e
+}
+
+// header returns the header buckets of t
+func (b *BandIndex) header(t *TLSH) (l, q1, q2 int) {
+	l, q1, q2 = -1, -1, -1
+	if b.opts.LengthBucket > 0 {
+		l = int(t.lValue) / b.opts.LengthBucket
+	}
+	if b.opts.QRatioBucket > 0 {
+		q1 = int(t.q1Ratio) / b.opts.QRatioBucket
+		q2 = int(t.q2Ratio) / b.opts.QRatioBucket
+	}
+	return l, q1, q2
+}
+
+// key hashes a band of t and the header buckets with FNV-1a
+func (b *BandIndex) key(t *TLSH, band, l, q1, q2 int) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for _, v := range [4]int{band, l, q1, q2} {
+		h ^= uint64(v)
+		h *= prime64
+	}
+	start, end := band*codeSize/b.opts.Bands, (band+1)*codeSize/b.opts.Bands
+	for _, c := range t.code[start:end] {
+		h ^= uint64(c)
+		h *= prime64
+	}
+	return h
+}
+
+// neighbours returns bucket and its adjacent buckets in a circular range of size values
+func neighbours(bucket, size, width int) []int {
+	if width == 0 {
+		return []int{bucket}
+	}
+	n := (size + width - 1) / width
+	if n < 3 {
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	return []int{(bucket + n - 1) % n, bucket, (bucket + 1) % n}
+}
+
+// SortMatches sorts matches by distance and index
+func SortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Index < matches[j].Index
+	})
+}
@@ -0,0 +1,96 @@
+package tlsh
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// mutatedHashes hashes n copies of filename with a few random bytes changed
+func mutatedHashes(tb testing.TB, filename string, n, changes int) []*TLSH {
+	blob, err := os.ReadFile(filename)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	var hashes []*TLSH
+	for i := 0; i < n; i++ {
+		b := append([]byte(nil), blob...)
+		for j := 0; j < changes; j++ {
+			b[r.Intn(len(b))] = byte(r.Intn(256))
+		}
+		h, err := HashBytes(b)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes
+}
+
+func TestBandIndex(t *testing.T) {
+	var corpus []*TLSH
+	for _, tc := range hashTestCases[:9] {
+		h, err := HashFilename(tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus = append(corpus, h)
+	}
+	corpus = append(corpus, mutatedHashes(t, "tests/test_file_3", 10, 20)...)
+
+	for _, opts := range []BandOptions{DefaultBandOptions, {Bands: 12, LengthBucket: 5, QRatioBucket: 4}, {Bands: 32}} {
+		idx, err := NewBandIndex(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range corpus {
+			idx.Add(h)
+		}
+		if idx.Len() != len(corpus) {
+			t.Errorf("\nexpected %d digests, got %d\n", len(corpus), idx.Len())
+		}
+
+		for i, h := range corpus {
+			matches := idx.Query(h, 100)
+			if len(matches) == 0 || matches[0].Distance != 0 {
+				t.Errorf("\n%v: digest %d not found: %v\n", opts, i, matches)
+			}
+			for _, m := range matches {
+				if d := h.Diff(idx.Hash(m.Index)); d != m.Distance || d > 100 {
+					t.Errorf("\n%v: wrong match %v, distance %d\n", opts, m, d)
+				}
+			}
+		}
+
+		e := idx.Evaluate(corpus, 0)
+		if e.Recall != 1 || e.Found != e.Expected || e.Queries != len(corpus) {
+			t.Errorf("\n%v: exact matches missed: %+v\n", opts, e)
+		}
+		e = idx.Evaluate(corpus, 100)
+		if e.Recall <= 0 || e.Recall > 1 || e.CandidateRatio <= 0 || e.CandidateRatio > 1 {
+			t.Errorf("\n%v: unexpected evaluation %+v\n", opts, e)
+		}
+		t.Logf("%+v: %+v", opts, e)
+	}
+}
+
+func TestNewBandIndexError(t *testing.T) {
+	for _, opts := range []BandOptions{{Bands: 0}, {Bands: 33}, {Bands: 8, LengthBucket: -1}} {
+		if _, err := NewBandIndex(opts); err == nil {
+			t.Errorf("\nmissing error for %+v\n", opts)
+		}
+	}
+}
+
+func BenchmarkBandIndexQuery(b *testing.B) {
+	corpus := mutatedHashes(b, "tests/test_file_3", 200, 50)
+	idx, _ := NewBandIndex(DefaultBandOptions)
+	for _, h := range corpus {
+		idx.Add(h)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		idx.Query(corpus[n%len(corpus)], 100)
+	}
+}
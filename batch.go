@@ -0,0 +1,138 @@
+package tlsh
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// BatchResult holds the digest of a single input of a batch
+type BatchResult struct {
+	// Index of the input in the batch
+	Index int
+	Hash  *TLSH
+	Err   error
+}
+
+// BatchHasher hashes many byte slices concurrently with a bounded number of
+// workers. The hashing state is reused across inputs instead of being
+// allocated for every call as HashBytes does.
+type BatchHasher struct {
+	workers int
+	states  sync.Pool
+}
+
+// NewBatchHasher returns a BatchHasher running up to workers hashes at a
+// time, GOMAXPROCS if workers is not positive
+func NewBatchHasher(workers int) *BatchHasher {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &BatchHasher{
+		workers: workers,
+		states: sync.Pool{
+			New: func() interface{} {
+				return &chunkState{chunk3: &[3]byte{}}
+			},
+		},
+	}
+}
+
+// HashBytes calculates the TLSH for the input byte slice like HashBytes
+func (h *BatchHasher) HashBytes(blob []byte) (*TLSH, error) {
+	s := h.states.Get().(*chunkState)
+	defer h.states.Put(s)
+
+	return s.hashBytes(blob)
+}
+
+// HashSlice hashes all blobs and returns the results in input order. Inputs
+// not hashed before ctx is done carry the context error.
+func (h *BatchHasher) HashSlice(ctx context.Context, blobs [][]byte) []BatchResult {
+	results := make([]BatchResult, len(blobs))
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for w := 0; w < h.workers && w < len(blobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(blobs) {
+					return
+				}
+				results[i].Index = i
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				results[i].Hash, results[i].Err = h.HashBytes(blobs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// HashChan hashes the blobs received from in and sends the results in input
+// order. The returned channel is closed once in is closed and all results are
+// sent, or once ctx is done.
+func (h *BatchHasher) HashChan(ctx context.Context, in <-chan []byte) <-chan BatchResult {
+	type job struct {
+		blob   []byte
+		result chan BatchResult
+	}
+	jobs := make(chan job)
+	pending := make(chan chan BatchResult, h.workers)
+	out := make(chan BatchResult)
+
+	for w := 0; w < h.workers; w++ {
+		go func() {
+			for j := range jobs {
+				hash, err := h.HashBytes(j.blob)
+				j.result <- BatchResult{Hash: hash, Err: err}
+			}
+		}()
+	}
+
+	// dispatch jobs and remember their order
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case blob, ok := <-in:
+				if !ok {
+					return
+				}
+				j := job{blob: blob, result: make(chan BatchResult, 1)}
+				select {
+				case pending <- j.result:
+				case <-ctx.Done():
+					return
+				}
+				jobs <- j
+			}
+		}
+	}()
+
+	// collect results in order
+	go func() {
+		defer close(out)
+		i := 0
+		for result := range pending {
+			r := <-result
+			r.Index = i
+			i++
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
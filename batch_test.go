@@ -0,0 +1,99 @@
+package tlsh
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func batchBlobs(tb testing.TB) [][]byte {
+	var blobs [][]byte
+	for _, tc := range hashTestCases {
+		blob, err := os.ReadFile(tc.filename)
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, blob)
+	}
+	return append(blobs, nil, []byte("short"))
+}
+
+func TestBatchHasherHashSlice(t *testing.T) {
+	blobs := batchBlobs(t)
+	h := NewBatchHasher(3)
+	for round := 0; round < 2; round++ {
+		for i, r := range h.HashSlice(context.Background(), blobs) {
+			expected, expectedErr := HashBytes(blobs[i])
+			if r.Index != i || r.Hash.String() != expected.String() || (r.Err == nil) != (expectedErr == nil) {
+				t.Errorf("\nresult %d: %s (%v) vs. %s (%v)\n", r.Index, r.Hash, r.Err, expected, expectedErr)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, r := range h.HashSlice(ctx, blobs) {
+		if r.Err != context.Canceled {
+			t.Errorf("\nresult %d: expected %v, got %v\n", r.Index, context.Canceled, r.Err)
+		}
+	}
+}
+
+func TestBatchHasherHashChan(t *testing.T) {
+	blobs := batchBlobs(t)
+	in := make(chan []byte)
+	go func() {
+		for _, blob := range blobs {
+			in <- blob
+		}
+		close(in)
+	}()
+
+	i := 0
+	for r := range NewBatchHasher(0).HashChan(context.Background(), in) {
+		expected, _ := HashBytes(blobs[i])
+		if r.Index != i || r.Hash.String() != expected.String() {
+			t.Errorf("\nresult %d: %s vs. %s\n", r.Index, r.Hash, expected)
+		}
+		i++
+	}
+	if i != len(blobs) {
+		t.Errorf("\nexpected %d results, got %d\n", len(blobs), i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range NewBatchHasher(2).HashChan(ctx, make(chan []byte)) {
+		t.Error("unexpected result after cancellation")
+	}
+}
+
+func BenchmarkHashBytes(b *testing.B) {
+	blobs := batchBlobs(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, blob := range blobs {
+			HashBytes(blob)
+		}
+	}
+}
+
+func BenchmarkBatchHasherHashBytes(b *testing.B) {
+	blobs := batchBlobs(b)
+	h := NewBatchHasher(1)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, blob := range blobs {
+			h.HashBytes(blob)
+		}
+	}
+}
+
+func BenchmarkBatchHasherHashSlice(b *testing.B) {
+	blobs := batchBlobs(b)
+	h := NewBatchHasher(0)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		h.HashSlice(context.Background(), blobs)
+	}
+}
@@ -0,0 +1,153 @@
+package tlsh
+
+import (
+	"errors"
+	"math"
+)
+
+// Preset is a distance threshold for a match decision
+type Preset struct {
+	Name      string
+	Threshold int
+}
+
+// Threshold presets for common operating points. Lower thresholds report
+// fewer false positives, higher thresholds detect more distant variants.
+// The presets are round values from the threshold range whose false positive
+// and detection rates are measured in Oliver, Cheng and Chen, "TLSH - A
+// Locality Sensitive Hash", 4th Cybercrime and Trustworthy Computing
+// Workshop, 2013. The rates of the paper hold for its corpus only, measure
+// them on your own data with the evaluate package.
+var (
+	// PresetLowFalsePositive only matches very close variants
+	PresetLowFalsePositive = Preset{Name: "low-false-positive", Threshold: 30}
+	// PresetBalanced trades false positives against detection
+	PresetBalanced = Preset{Name: "balanced", Threshold: 50}
+	// PresetHighDetection matches distant variants at the cost of more false positives
+	PresetHighDetection = Preset{Name: "high-detection", Threshold: 100}
+)
+
+// Presets lists the built-in presets by name
+var Presets = map[string]Preset{
+	PresetLowFalsePositive.Name: PresetLowFalsePositive,
+	PresetBalanced.Name:         PresetBalanced,
+	PresetHighDetection.Name:    PresetHighDetection,
+}
+
+// Match reports whether distance is within the preset threshold
+func (p Preset) Match(distance int) bool {
+	return distance >= 0 && distance <= p.Threshold
+}
+
+// Calibration maps distances to match probabilities with the logistic curve
+// 1 / (1 + exp(Slope * (distance - Midpoint)))
+type Calibration struct {
+	// Midpoint is the distance with a match probability of 0.5
+	Midpoint float64
+	// Slope is how fast the probability drops with the distance
+	Slope float64
+}
+
+// DefaultCalibration is an uncalibrated curve dropping from 0.99 at distance
+// 30 to 0.01 at distance 110, spanning the low false positive and high
+// detection presets. It is not fitted to any data and its values are
+// heuristic scores rather than probabilities. Fit a calibration to labelled
+// data with FitCalibration for probabilities that hold for a corpus.
+var DefaultCalibration = Calibration{
+	Midpoint: 70,
+	Slope:    math.Log(99) / 40,
+}
+
+// Probability returns the probability that two digests at distance are a
+// match. It is only a probability for a calibration fitted to labelled data.
+func (c Calibration) Probability(distance int) float64 {
+	return 1 / (1 + math.Exp(c.Slope*(float64(distance)-c.Midpoint)))
+}
+
+// Score returns Probability as a similarity score from 0 to 100
+func (c Calibration) Score(distance int) int {
+	return int(math.Round(100 * c.Probability(distance)))
+}
+
+// Threshold returns the largest distance with a match probability of at
+// least p, or -1 if no distance reaches p
+func (c Calibration) Threshold(p float64) int {
+	if p <= 0 || p >= 1 || c.Slope <= 0 {
+		return -1
+	}
+	d := int(math.Floor(c.Midpoint - math.Log(1/p-1)/c.Slope))
+	for d >= 0 && c.Probability(d) < p {
+		d--
+	}
+	return d
+}
+
+// LabelledDistance is the distance between two samples known to be of the
+// same or of different families
+type LabelledDistance struct {
+	Distance int
+	Same     bool
+}
+
+const (
+	// calibrationScale scales distances to keep the fit well conditioned
+	calibrationScale = 100
+	// calibrationRidge regularises the fit of perfectly separable samples
+	calibrationRidge = 1e-3
+	calibrationSteps = 100
+)
+
+// FitCalibration fits a calibration to labelled distances with a logistic
+// regression. Both same and different family pairs are required.
+func FitCalibration(samples []LabelledDistance) (Calibration, error) {
+	var same, different int
+	for _, s := range samples {
+		if s.Same {
+			same++
+		} else {
+			different++
+		}
+	}
+	if same == 0 || different == 0 {
+		return Calibration{}, errors.New("calibration needs same and different family pairs")
+	}
+
+	// Newton's method on p = sigmoid(w0 + w1*x) with x the scaled distance
+	var w0, w1 float64
+	for step := 0; step < calibrationSteps; step++ {
+		g0, g1 := -calibrationRidge*w0, -calibrationRidge*w1
+		h00, h01, h11 := calibrationRidge, 0.0, calibrationRidge
+		for _, s := range samples {
+			x := float64(s.Distance) / calibrationScale
+			p := 1 / (1 + math.Exp(-(w0 + w1*x)))
+			y := 0.0
+			if s.Same {
+				y = 1
+			}
+			g0 += y - p
+			g1 += (y - p) * x
+			v := p * (1 - p)
+			h00 += v
+			h01 += v * x
+			h11 += v * x * x
+		}
+		det := h00*h11 - h01*h01
+		if det == 0 {
+			break
+		}
+		d0 := (h11*g0 - h01*g1) / det
+		d1 := (h00*g1 - h01*g0) / det
+		w0 += d0
+		w1 += d1
+		if math.Abs(d0) < 1e-9 && math.Abs(d1) < 1e-9 {
+			break
+		}
+	}
+	if w1 >= 0 {
+		return Calibration{}, errors.New("same family pairs are not closer than different family pairs")
+	}
+	return Calibration{
+		Midpoint: -w0 / w1 * calibrationScale,
+		Slope:    -w1 / calibrationScale,
+	}, nil
+}
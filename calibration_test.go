@@ -0,0 +1,77 @@
+package tlsh
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPreset(t *testing.T) {
+	presetTestCases := []struct {
+		preset   Preset
+		distance int
+		match    bool
+	}{
+		{PresetLowFalsePositive, 30, true},
+		{PresetLowFalsePositive, 31, false},
+		{PresetBalanced, 0, true},
+		{PresetHighDetection, 100, true},
+		{PresetHighDetection, -1, false},
+	}
+	for _, tc := range presetTestCases {
+		if tc.preset.Match(tc.distance) != tc.match {
+			t.Errorf("\n%s: distance %d should match: %t\n", tc.preset.Name, tc.distance, tc.match)
+		}
+	}
+	if Presets["balanced"] != PresetBalanced {
+		t.Error("balanced preset not registered")
+	}
+}
+
+func TestDefaultCalibration(t *testing.T) {
+	c := DefaultCalibration
+	if p := c.Probability(30); math.Abs(p-0.99) > 1e-6 {
+		t.Errorf("\nwrong probability at 30: %f\n", p)
+	}
+	if s := c.Score(70); s != 50 {
+		t.Errorf("\nwrong score at 70: %d\n", s)
+	}
+	if s := c.Score(1000); s != 0 {
+		t.Errorf("\nwrong score at 1000: %d\n", s)
+	}
+	if d := c.Threshold(0.99); d != 30 {
+		t.Errorf("\nwrong threshold for 0.99: %d\n", d)
+	}
+	if d := c.Threshold(1); d != -1 {
+		t.Errorf("\nwrong threshold for 1: %d\n", d)
+	}
+}
+
+func TestFitCalibration(t *testing.T) {
+	var samples []LabelledDistance
+	// same family pairs mostly below 60, different family pairs mostly above
+	for d := 0; d <= 200; d += 5 {
+		samples = append(samples, LabelledDistance{Distance: d, Same: d < 60 || d == 80})
+	}
+	c, err := FitCalibration(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Midpoint < 50 || c.Midpoint > 80 || c.Slope <= 0 {
+		t.Errorf("\nunexpected calibration %+v\n", c)
+	}
+	if c.Probability(10) < 0.9 || c.Probability(150) > 0.1 {
+		t.Errorf("\ncalibration %+v does not separate the families\n", c)
+	}
+
+	separable := []LabelledDistance{{10, true}, {20, true}, {200, false}, {300, false}}
+	if c, err := FitCalibration(separable); err != nil || c.Probability(10) < 0.9 || c.Probability(300) > 0.1 {
+		t.Errorf("\nunexpected calibration %+v for separable samples (%v)\n", c, err)
+	}
+
+	if _, err := FitCalibration([]LabelledDistance{{10, true}}); err == nil {
+		t.Error("missing error for a single class")
+	}
+	if _, err := FitCalibration([]LabelledDistance{{10, false}, {200, true}}); err == nil {
+		t.Error("missing error for inverted classes")
+	}
+}
@@ -0,0 +1,111 @@
+package tlsh
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// checksum3Size is the number of checksum bytes of the tlsh-128-3 variant
+const checksum3Size = 3
+
+// tlsh3 is the digest of the tlsh-128-3 variant, a TLSH with a 3 byte
+// checksum. The first checksum byte is the checksum of the TLSH.
+type tlsh3 struct {
+	hash     *TLSH
+	checksum [checksum3Size]byte
+}
+
+// Binary returns the binary representation of the digest
+func (t *tlsh3) Binary() []byte {
+	b := make([]byte, 0, checksum3Size+2+codeSize)
+	for _, c := range t.checksum {
+		b = append(b, swapByte(c))
+	}
+	return append(append(b, swapByte(t.hash.lValue), t.hash.qRatio), t.hash.code[:]...)
+}
+
+// String returns the string representation of the digest
+func (t *tlsh3) String() string {
+	return hex.EncodeToString(t.Binary())
+}
+
+// Distance returns the distance to another tlsh-128-3 digest like Diff, a
+// difference in any checksum byte adds 1
+func (t *tlsh3) Distance(other Digest) (int, error) {
+	o, ok := other.(*tlsh3)
+	if !ok {
+		return -1, ErrDigestMismatch
+	}
+	d := t.hash.Diff(o.hash)
+	if t.checksum[0] == o.checksum[0] && t.checksum != o.checksum {
+		d++
+	}
+	return d, nil
+}
+
+// checksum3Writer calculates the checksum bytes of the tlsh-128-3 variant
+// over the bytes written to it, following the sliding window of chunkState
+type checksum3Writer struct {
+	checksum [checksum3Size]byte
+	prev     byte
+	n        int
+}
+
+func (c *checksum3Writer) Write(p []byte) (int, error) {
+	for _, b := range p {
+		// the checksum is updated once the first window is complete
+		if c.n >= windowLength-1 {
+			keys := [3]byte{b, c.prev, c.checksum[0]}
+			c.checksum[0] = pearsonHash(0, &keys)
+			for k := 1; k < checksum3Size; k++ {
+				keys[2] = c.checksum[k]
+				c.checksum[k] = pearsonHash(c.checksum[k-1], &keys)
+			}
+		}
+		c.prev = b
+		c.n++
+	}
+	return len(p), nil
+}
+
+// checksum3Hasher is the Hasher of the tlsh-128-3 variant
+type checksum3Hasher struct{}
+
+func (checksum3Hasher) Name() string {
+	return "tlsh-128-3"
+}
+
+func (h checksum3Hasher) HashBytes(blob []byte) (Digest, error) {
+	return h.HashReader(bytes.NewReader(blob))
+}
+
+func (checksum3Hasher) HashReader(r io.Reader) (Digest, error) {
+	c := &checksum3Writer{}
+	t, err := HashReader(io.TeeReader(r, c))
+	if err != nil {
+		return nil, err
+	}
+	return &tlsh3{hash: t, checksum: c.checksum}, nil
+}
+
+func (checksum3Hasher) Parse(s string) (Digest, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != checksum3Size+2+codeSize {
+		return nil, errors.New("invalid tlsh-128-3 hash length")
+	}
+	t, err := ParseBinaryToTlsh(b[checksum3Size-1:])
+	if err != nil {
+		return nil, err
+	}
+	d := &tlsh3{hash: t}
+	for k := range d.checksum {
+		d.checksum[k] = swapByte(b[k])
+	}
+	t.checksum = d.checksum[0]
+	return d, nil
+}
@@ -0,0 +1,145 @@
+package tlsh
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// ChunkOptions configures the content-defined chunking of HashChunks
+type ChunkOptions struct {
+	// MinSize is the minimum chunk size in bytes
+	MinSize int
+	// AvgSize is the expected distance between chunk boundaries after
+	// MinSize, rounded down to a power of two
+	AvgSize int
+	// MaxSize is the maximum chunk size in bytes
+	MaxSize int
+}
+
+// DefaultChunkOptions splits large files into chunks of about 320 KiB
+var DefaultChunkOptions = ChunkOptions{
+	MinSize: 64 << 10,
+	AvgSize: 256 << 10,
+	MaxSize: 1 << 20,
+}
+
+// gearTable holds the random values of the gear rolling hash
+var gearTable = newGearTable()
+
+// newGearTable fills the gear table from a splitmix64 sequence
+func newGearTable() [256]uint64 {
+	var table [256]uint64
+	x := uint64(0x9E3779B97F4A7C15)
+	for i := range table {
+		x += 0x9E3779B97F4A7C15
+		z := x
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}
+
+// HashChunks splits the input into content-defined chunks and calculates the
+// TLSH of every chunk. Chunk boundaries are found with a gear rolling hash
+// over the last 64 bytes, so they resynchronise after insertions or
+// deletions and shared content yields identical chunks.
+func HashChunks(r io.Reader, opts ChunkOptions) ([]Segment, error) {
+	if opts.MinSize < 0 || opts.AvgSize < 1 || opts.MaxSize < opts.MinSize || opts.MaxSize < 1 {
+		return nil, errors.New("chunk sizes must be positive and max size not smaller than min size")
+	}
+	shift := uint(64 - (bits.Len(uint(opts.AvgSize)) - 1))
+
+	var (
+		segments []Segment
+		gear     uint64
+		offset   int64
+		size     int
+	)
+	s := &chunkState{}
+	s.reset()
+	buf := readBuffers.Get().(*[readBufferSize]byte)
+	defer readBuffers.Put(buf)
+
+	for {
+		n, err := r.Read(buf[:])
+		start := 0
+		for i := 0; i < n; i++ {
+			gear = gear<<1 + gearTable[buf[i]]
+			size++
+			if size < opts.MinSize || (size < opts.MaxSize && gear>>shift != 0) {
+				continue
+			}
+			s.update(buf[start : i+1])
+			segments = append(segments, segment(segmentWindow{offset: offset, state: s}, int64(size)))
+			offset += int64(size)
+			start, size, gear = i+1, 0, 0
+			s.reset()
+		}
+		s.update(buf[start:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return segments, err
+		}
+	}
+	if size > 0 {
+		segments = append(segments, segment(segmentWindow{offset: offset, state: s}, int64(size)))
+	}
+	return segments, nil
+}
+
+// ChunkSimilarity describes how much of one chunked input is found in another
+type ChunkSimilarity struct {
+	// MeanDistance is the mean distance of every chunk of the first input to
+	// its closest chunk of the second, weighted by chunk length
+	MeanDistance float64
+	// Containment is the fraction of bytes of the first input in chunks
+	// within the threshold of a chunk of the second
+	Containment float64
+	// Matches is the number of chunks of the first input within the threshold
+	Matches int
+}
+
+// CompareChunks scores how much of a is contained in b by matching every
+// chunk of a with its closest chunk in b. The score is not symmetric, swap
+// the arguments to score how much of b is contained in a. Chunks that could
+// not be hashed are ignored.
+func CompareChunks(a, b []Segment, threshold int) ChunkSimilarity {
+	var (
+		sim      ChunkSimilarity
+		total    int64
+		weighted float64
+		matched  int64
+	)
+	for _, ca := range a {
+		if ca.Hash == nil {
+			continue
+		}
+		best := -1
+		for _, cb := range b {
+			if cb.Hash == nil {
+				continue
+			}
+			if d := ca.Hash.Diff(cb.Hash); best < 0 || d < best {
+				best = d
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		total += ca.Length
+		weighted += float64(best) * float64(ca.Length)
+		if best <= threshold {
+			sim.Matches++
+			matched += ca.Length
+		}
+	}
+	if total > 0 {
+		sim.MeanDistance = weighted / float64(total)
+		sim.Containment = float64(matched) / float64(total)
+	}
+	return sim
+}
@@ -0,0 +1,81 @@
+package tlsh
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+var testChunkOptions = ChunkOptions{MinSize: 1024, AvgSize: 4096, MaxSize: 16384}
+
+func TestHashChunks(t *testing.T) {
+	blob, err := os.ReadFile("tests/test_file_9_tinyssl.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := HashChunks(iotest.HalfReader(bytes.NewReader(blob)), testChunkOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("\nexpected several chunks, got %d\n", len(chunks))
+	}
+	var offset int64
+	for i, c := range chunks {
+		if c.Offset != offset {
+			t.Errorf("\nchunk %d at offset %d instead of %d\n", i, c.Offset, offset)
+		}
+		if c.Length > int64(testChunkOptions.MaxSize) || (c.Length < int64(testChunkOptions.MinSize) && i < len(chunks)-1) {
+			t.Errorf("\nchunk %d has length %d\n", i, c.Length)
+		}
+		expected, expectedErr := HashBytes(blob[c.Offset : c.Offset+c.Length])
+		if (c.Err == nil) != (expectedErr == nil) || (c.Hash != nil && c.Hash.String() != expected.String()) {
+			t.Errorf("\nchunk %d %s (%v) vs. %s (%v)\n", i, c.Hash, c.Err, expected, expectedErr)
+		}
+		offset += c.Length
+	}
+	if offset != int64(len(blob)) {
+		t.Errorf("\nchunks end at %d instead of %d\n", offset, len(blob))
+	}
+
+	for _, opts := range []ChunkOptions{{MinSize: 10, AvgSize: 0, MaxSize: 100}, {MinSize: 100, AvgSize: 10, MaxSize: 10}} {
+		if _, err := HashChunks(bytes.NewReader(blob), opts); err == nil {
+			t.Errorf("\nmissing error for %+v\n", opts)
+		}
+	}
+}
+
+func TestCompareChunks(t *testing.T) {
+	exe, err := os.ReadFile("tests/test_file_9_tinyssl.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	png, err := os.ReadFile("tests/test_file_8_lena.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second half of exe embedded behind unrelated data
+	embedded := append(append([]byte(nil), png[:5000]...), exe[len(exe)/2:]...)
+
+	ca, _ := HashChunks(bytes.NewReader(exe), testChunkOptions)
+	cb, _ := HashChunks(bytes.NewReader(embedded), testChunkOptions)
+	cp, _ := HashChunks(bytes.NewReader(png), testChunkOptions)
+
+	if sim := CompareChunks(ca, ca, 0); sim.Containment != 1 || sim.MeanDistance != 0 {
+		t.Errorf("\nunexpected self similarity %+v\n", sim)
+	}
+	if sim := CompareChunks(cb, ca, 30); sim.Containment < 0.5 {
+		t.Errorf("\nembedded content not found %+v\n", sim)
+	}
+	// chunk boundaries resynchronise, so the tail chunks are identical
+	if sim := CompareChunks(cb[len(cb)-5:], ca, 0); sim.Containment != 1 {
+		t.Errorf("\nidentical chunks not found %+v\n", sim)
+	}
+	if sim := CompareChunks(cp, ca, 30); sim.Containment > 0.2 {
+		t.Errorf("\nunrelated content found %+v\n", sim)
+	}
+	if sim := CompareChunks(nil, ca, 30); sim.Matches != 0 || sim.Containment != 0 {
+		t.Errorf("\nunexpected similarity of empty chunks %+v\n", sim)
+	}
+}
@@ -0,0 +1,210 @@
+// Package cluster groups similar TLSH digests
+package cluster
+
+import (
+	"errors"
+
+	"github.com/glaslos/tlsh"
+)
+
+// Noise is the label of digests not in any cluster
+const Noise = -1
+
+// ErrNilHash is returned for inputs holding a nil digest
+var ErrNilHash = errors.New("cannot cluster nil digests")
+
+// NeighbourIndex finds the digests within a distance of a digest. The index
+// must hold the clustered digests in order, so a Match Index is the position
+// of the digest in the clustered slice. tlsh.BandIndex and tlsh.ShardedIndex
+// filled in order are neighbour indexes.
+type NeighbourIndex interface {
+	Query(t *tlsh.TLSH, threshold int) []tlsh.Match
+}
+
+// Result labels every digest with its cluster
+type Result struct {
+	// Labels holds the cluster of every digest, from 0 in order of the first
+	// digest of each cluster, or Noise
+	Labels []int
+	// Clusters is the number of clusters
+	Clusters int
+	// Noise holds the indices of the digests not in any cluster
+	Noise []int
+}
+
+// Members returns the indices of the digests of every cluster
+func (r Result) Members() [][]int {
+	members := make([][]int, r.Clusters)
+	for i, l := range r.Labels {
+		if l != Noise {
+			members[l] = append(members[l], i)
+		}
+	}
+	return members
+}
+
+// checkHashes returns ErrNilHash if any digest is nil
+func checkHashes(hashes []*tlsh.TLSH) error {
+	for _, h := range hashes {
+		if h == nil {
+			return ErrNilHash
+		}
+	}
+	return nil
+}
+
+// NewBandIndex returns a tlsh.BandIndex of the hashes, the default neighbour
+// index. Only digests sharing a band of their body are compared, so the cost
+// grows with the number of similar digests instead of all pairs, but
+// neighbours beyond a distance of about 100 may be missed and split clusters.
+func NewBandIndex(hashes []*tlsh.TLSH, opts tlsh.BandOptions) (*tlsh.BandIndex, error) {
+	if err := checkHashes(hashes); err != nil {
+		return nil, err
+	}
+	b, err := tlsh.NewBandIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hashes {
+		b.Add(h)
+	}
+	return b, nil
+}
+
+// NewExactIndex returns a tlsh.ShardedIndex of the hashes. It finds every
+// neighbour, but only prunes by length, so clustering n digests of similar
+// length takes n² comparisons.
+func NewExactIndex(hashes []*tlsh.TLSH) (*tlsh.ShardedIndex, error) {
+	if err := checkHashes(hashes); err != nil {
+		return nil, err
+	}
+	s, err := tlsh.NewShardedIndex(256)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hashes {
+		s.Insert(h)
+	}
+	return s, nil
+}
+
+// neighbourIndex returns index, or a band index of the hashes if it is nil
+func neighbourIndex(hashes []*tlsh.TLSH, index NeighbourIndex) (NeighbourIndex, error) {
+	if err := checkHashes(hashes); err != nil {
+		return nil, err
+	}
+	if index != nil {
+		return index, nil
+	}
+	return NewBandIndex(hashes, tlsh.DefaultBandOptions)
+}
+
+// DBSCAN clusters the digests by density. Digests with at least minPts
+// digests, themselves included, within eps are core digests, and clusters
+// are the core digests linked within eps plus the digests within eps of
+// them. Neighbours are found with index, a nil index uses NewBandIndex with
+// tlsh.DefaultBandOptions. Pass NewExactIndex to find all neighbours at the
+// cost of comparing all pairs of digests of similar length.
+func DBSCAN(hashes []*tlsh.TLSH, eps, minPts int, index NeighbourIndex) (Result, error) {
+	index, err := neighbourIndex(hashes, index)
+	if err != nil {
+		return Result{}, err
+	}
+	const unvisited = -2
+	r := Result{Labels: make([]int, len(hashes))}
+	for i := range r.Labels {
+		r.Labels[i] = unvisited
+	}
+	for i, h := range hashes {
+		if r.Labels[i] != unvisited {
+			continue
+		}
+		neighbours := index.Query(h, eps)
+		if len(neighbours) < minPts {
+			r.Labels[i] = Noise
+			continue
+		}
+		label := r.Clusters
+		r.Clusters++
+		r.Labels[i] = label
+		queue := neighbours
+		for len(queue) > 0 {
+			j := queue[0].Index
+			queue = queue[1:]
+			if r.Labels[j] == Noise {
+				// border digest
+				r.Labels[j] = label
+			}
+			if r.Labels[j] != unvisited {
+				continue
+			}
+			r.Labels[j] = label
+			if n := index.Query(hashes[j], eps); len(n) >= minPts {
+				queue = append(queue, n...)
+			}
+		}
+	}
+	for i, l := range r.Labels {
+		if l == Noise {
+			r.Noise = append(r.Noise, i)
+		}
+	}
+	return r, nil
+}
+
+// Components clusters the digests into the connected components of the graph
+// linking all digests within threshold. Digests linked to no other digest
+// are noise. Neighbours are found with index like in DBSCAN.
+func Components(hashes []*tlsh.TLSH, threshold int, index NeighbourIndex) (Result, error) {
+	index, err := neighbourIndex(hashes, index)
+	if err != nil {
+		return Result{}, err
+	}
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	linked := make([]bool, len(hashes))
+	for i, h := range hashes {
+		for _, m := range index.Query(h, threshold) {
+			if m.Index == i {
+				continue
+			}
+			linked[i], linked[m.Index] = true, true
+			if a, b := find(i), find(m.Index); a != b {
+				// keep the smallest index as root
+				if a < b {
+					parent[b] = a
+				} else {
+					parent[a] = b
+				}
+			}
+		}
+	}
+
+	r := Result{Labels: make([]int, len(hashes))}
+	labels := map[int]int{}
+	for i := range hashes {
+		if !linked[i] {
+			r.Labels[i] = Noise
+			r.Noise = append(r.Noise, i)
+			continue
+		}
+		root := find(i)
+		l, ok := labels[root]
+		if !ok {
+			l = r.Clusters
+			labels[root] = l
+			r.Clusters++
+		}
+		r.Labels[i] = l
+	}
+	return r, nil
+}
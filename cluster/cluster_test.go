@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/glaslos/tlsh"
+)
+
+// families returns n mutated digests of every file, grouped by file, and
+// the digest of test_file_1 as an outlier
+func families(tb testing.TB, n int) []*tlsh.TLSH {
+	r := rand.New(rand.NewSource(1))
+	var hashes []*tlsh.TLSH
+	for _, filename := range []string{
+		"../tests/test_file_3",
+		"../tests/test_file_7_lena.jpg",
+		"../tests/test_file_9_tinyssl.exe",
+		"../tests/test_file_1",
+	} {
+		blob, err := os.ReadFile(filename)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		copies := n
+		if filename == "../tests/test_file_1" {
+			copies = 1
+		}
+		for i := 0; i < copies; i++ {
+			b := append([]byte(nil), blob...)
+			for j := 0; j < 5; j++ {
+				b[r.Intn(len(b))] = byte(r.Intn(256))
+			}
+			h, err := tlsh.HashBytes(b)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+// checkFamilies verifies that every family of n digests is one cluster and
+// the last digest is noise
+func checkFamilies(t *testing.T, r Result, n int) {
+	t.Helper()
+	if r.Clusters != 3 || len(r.Noise) != 1 || r.Noise[0] != 3*n {
+		t.Fatalf("\nexpected 3 clusters and 1 noise digest, got %d and %v\n", r.Clusters, r.Noise)
+	}
+	for i, l := range r.Labels[:3*n] {
+		if l != i/n {
+			t.Errorf("\ndigest %d: expected cluster %d, got %d\n", i, i/n, l)
+		}
+	}
+	for c, members := range r.Members() {
+		if len(members) != n || members[0] != c*n {
+			t.Errorf("\nunexpected members %v of cluster %d\n", members, c)
+		}
+	}
+}
+
+func TestDBSCAN(t *testing.T) {
+	hashes := families(t, 10)
+	r, err := DBSCAN(hashes, 100, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFamilies(t, r, 10)
+
+	exact, err := NewExactIndex(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err = DBSCAN(hashes, 100, 3, exact); err != nil {
+		t.Fatal(err)
+	}
+	checkFamilies(t, r, 10)
+
+	// no digest has enough neighbours
+	if r, _ = DBSCAN(hashes, 100, 20, nil); r.Clusters != 0 || len(r.Noise) != len(hashes) {
+		t.Errorf("\nexpected only noise, got %d clusters\n", r.Clusters)
+	}
+	if _, err := DBSCAN([]*tlsh.TLSH{nil}, 100, 3, nil); err != ErrNilHash {
+		t.Errorf("\nexpected %v, got %v\n", ErrNilHash, err)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	hashes := families(t, 10)
+	r, err := Components(hashes, 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFamilies(t, r, 10)
+
+	exact, err := NewExactIndex(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ = Components(hashes, 1<<20, exact); r.Clusters != 1 || len(r.Noise) != 0 {
+		t.Errorf("\nexpected a single cluster, got %d and noise %v\n", r.Clusters, r.Noise)
+	}
+	if r, _ = Components(hashes, -1, nil); r.Clusters != 0 || len(r.Noise) != len(hashes) {
+		t.Errorf("\nexpected only noise, got %d clusters\n", r.Clusters)
+	}
+	if _, err := Components([]*tlsh.TLSH{nil}, 100, nil); err != ErrNilHash {
+		t.Errorf("\nexpected %v, got %v\n", ErrNilHash, err)
+	}
+	if _, err := NewExactIndex([]*tlsh.TLSH{nil}); err != ErrNilHash {
+		t.Errorf("\nexpected %v, got %v\n", ErrNilHash, err)
+	}
+}
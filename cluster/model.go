@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/glaslos/tlsh"
+)
+
+// Cluster is a cluster of a Model
+type Cluster struct {
+	// ID of the cluster, its index in Model.Clusters
+	ID int
+	// Representative is the digest new digests are compared to
+	Representative *tlsh.TLSH
+	// Size is the number of digests assigned to the cluster
+	Size int
+}
+
+// Model assigns digests to clusters incrementally. It is not safe for
+// concurrent use.
+type Model struct {
+	// Threshold is the largest distance of a digest to the representative of
+	// the cluster it is assigned to
+	Threshold int
+	// Clusters must only be changed through Assign
+	Clusters []Cluster
+	// representatives mirrors the representatives of Clusters for Search
+	representatives []*tlsh.TLSH
+}
+
+// Assignment is the cluster a digest was assigned to
+type Assignment struct {
+	Cluster int
+	// Distance to the representative of the cluster
+	Distance int
+	// New is set if the digest was too far from all clusters and created one
+	New bool
+}
+
+// NewModel builds a model from the connected components of the digests
+// within threshold, found with the default index of Components. Digests
+// linked to no other digest form clusters of their own. The medoid of a
+// cluster is its representative.
+func NewModel(hashes []*tlsh.TLSH, threshold int) (*Model, error) {
+	r, err := Components(hashes, threshold, nil)
+	if err != nil {
+		return nil, err
+	}
+	m := &Model{Threshold: threshold}
+	for _, members := range r.Members() {
+		cluster := make([]*tlsh.TLSH, len(members))
+		for i, j := range members {
+			cluster[i] = hashes[j]
+		}
+		medoid, err := Medoid(cluster)
+		if err != nil {
+			return nil, err
+		}
+		m.add(cluster[medoid], len(members))
+	}
+	for _, i := range r.Noise {
+		m.add(hashes[i], 1)
+	}
+	return m, nil
+}
+
+func (m *Model) add(representative *tlsh.TLSH, size int) int {
+	id := len(m.Clusters)
+	m.Clusters = append(m.Clusters, Cluster{ID: id, Representative: representative, Size: size})
+	m.representatives = append(m.representatives, representative)
+	return id
+}
+
+// Nearest returns the cluster with the closest representative within the
+// threshold without assigning the digest. It returns false if there is none.
+func (m *Model) Nearest(t *tlsh.TLSH) (Assignment, bool) {
+	matches := tlsh.Search(t, m.representatives, 1, m.Threshold)
+	if len(matches) == 0 {
+		return Assignment{}, false
+	}
+	return Assignment{Cluster: matches[0].Index, Distance: matches[0].Distance}, true
+}
+
+// Assign adds the digest to the cluster with the closest representative
+// within the threshold, or to a new cluster it represents
+func (m *Model) Assign(t *tlsh.TLSH) (Assignment, error) {
+	if t == nil {
+		return Assignment{}, ErrNilHash
+	}
+	if a, ok := m.Nearest(t); ok {
+		m.Clusters[a.Cluster].Size++
+		return a, nil
+	}
+	return Assignment{Cluster: m.add(t, 1), New: true}, nil
+}
+
+// modelJSON is the persisted form of a Model
+type modelJSON struct {
+	Threshold int           `json:"threshold"`
+	Clusters  []clusterJSON `json:"clusters"`
+}
+
+type clusterJSON struct {
+	ID             int    `json:"id"`
+	Representative string `json:"representative"`
+	Size           int    `json:"size"`
+}
+
+// Save writes the model as JSON
+func (m *Model) Save(w io.Writer) error {
+	out := modelJSON{Threshold: m.Threshold, Clusters: make([]clusterJSON, len(m.Clusters))}
+	for i, c := range m.Clusters {
+		out.Clusters[i] = clusterJSON{ID: c.ID, Representative: c.Representative.String(), Size: c.Size}
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// LoadModel reads a model written by Save
+func LoadModel(r io.Reader) (*Model, error) {
+	var in modelJSON
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, err
+	}
+	m := &Model{Threshold: in.Threshold}
+	for i, c := range in.Clusters {
+		if c.ID != i {
+			return nil, errors.New("cluster ids must match their position")
+		}
+		h, err := tlsh.ParseStringToTlsh(c.Representative)
+		if err != nil {
+			return nil, err
+		}
+		m.add(h, c.Size)
+	}
+	return m, nil
+}
@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestModel(t *testing.T) {
+	hashes := families(t, 10)
+	m, err := NewModel(hashes[:25], 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Clusters) != 3 || m.Clusters[0].Size != 10 || m.Clusters[2].Size != 5 {
+		t.Fatalf("\nunexpected clusters %+v\n", m.Clusters)
+	}
+
+	var buf bytes.Buffer
+	if err := m.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadModel(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Threshold != 100 || len(loaded.Clusters) != 3 || loaded.Clusters[1].Representative.String() != m.Clusters[1].Representative.String() {
+		t.Errorf("\nloaded model differs: %+v\n", loaded.Clusters)
+	}
+
+	for _, h := range hashes[25:30] {
+		a, err := loaded.Assign(h)
+		if err != nil || a.Cluster != 2 || a.New || a.Distance > 100 {
+			t.Errorf("\nunexpected assignment %+v (%v)\n", a, err)
+		}
+	}
+	a, err := loaded.Assign(hashes[30])
+	if err != nil || !a.New || a.Cluster != 3 || a.Distance != 0 {
+		t.Errorf("\nexpected a new cluster, got %+v (%v)\n", a, err)
+	}
+	if loaded.Clusters[2].Size != 10 || loaded.Clusters[3].Size != 1 {
+		t.Errorf("\nunexpected sizes %+v\n", loaded.Clusters)
+	}
+	if a, ok := loaded.Nearest(hashes[30]); !ok || a.Cluster != 3 || loaded.Clusters[3].Size != 1 {
+		t.Errorf("\nunexpected nearest cluster %+v\n", a)
+	}
+	if _, err := loaded.Assign(nil); err != ErrNilHash {
+		t.Errorf("\nexpected %v, got %v\n", ErrNilHash, err)
+	}
+
+	if _, err := LoadModel(bytes.NewBufferString(`{"clusters":[{"id":1}]}`)); err == nil {
+		t.Error("missing error for invalid cluster id")
+	}
+	if _, err := LoadModel(bytes.NewBufferString(`{"clusters":[{"id":0,"representative":"zz"}]}`)); err == nil {
+		t.Error("missing error for invalid representative")
+	}
+}
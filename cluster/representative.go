@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/glaslos/tlsh"
+)
+
+// ErrEmpty is returned for an empty set of digests
+var ErrEmpty = errors.New("no digests")
+
+// Medoid returns the index of the digest with the smallest sum of distances
+// to all other digests, the first of them on ties. It compares every pair of
+// digests.
+func Medoid(hashes []*tlsh.TLSH) (int, error) {
+	if len(hashes) == 0 {
+		return -1, ErrEmpty
+	}
+	for _, h := range hashes {
+		if h == nil {
+			return -1, ErrNilHash
+		}
+	}
+	sums := make([]int, len(hashes))
+	for i, a := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			d := a.Diff(hashes[j])
+			sums[i] += d
+			sums[j] += d
+		}
+	}
+	best := 0
+	for i, s := range sums {
+		if s < sums[best] {
+			best = i
+		}
+	}
+	return best, nil
+}
+
+// Consensus returns a synthetic digest of the most frequent code of every
+// bucket, the lower one on ties, the median length and quartile ratios and
+// the most frequent checksum of the digests
+func Consensus(hashes []*tlsh.TLSH) (*tlsh.TLSH, error) {
+	if len(hashes) == 0 {
+		return nil, ErrEmpty
+	}
+	var (
+		votes     [128][4]int
+		checksums [256]int
+		lValues   = make([]int, len(hashes))
+		q1Ratios  = make([]int, len(hashes))
+		q2Ratios  = make([]int, len(hashes))
+	)
+	for i, h := range hashes {
+		if h == nil {
+			return nil, ErrNilHash
+		}
+		for b, c := range h.Buckets() {
+			votes[b][c]++
+		}
+		checksums[h.Checksum()]++
+		lValues[i] = int(h.LValue())
+		q1Ratios[i] = int(h.Q1Ratio())
+		q2Ratios[i] = int(h.Q2Ratio())
+	}
+
+	var body [32]byte
+	for b, v := range votes {
+		code := 0
+		for c := 1; c < 4; c++ {
+			if v[c] > v[code] {
+				code = c
+			}
+		}
+		body[31-b/4] |= byte(code) << uint(2*(b%4))
+	}
+	checksum := 0
+	for c, n := range checksums {
+		if n > checksums[checksum] {
+			checksum = c
+		}
+	}
+	return tlsh.FromComponents(byte(checksum), median(lValues), median(q1Ratios), median(q2Ratios), body)
+}
+
+// median returns the lower median of the values
+func median(values []int) byte {
+	sort.Ints(values)
+	return byte(values[(len(values)-1)/2])
+}
+
+// Spread is the distance of a set of digests to their representative
+type Spread struct {
+	// Radius is the largest distance to the representative
+	Radius int
+	// MeanDistance is the mean distance to the representative
+	MeanDistance float64
+}
+
+// Measure returns the spread of the digests around the representative
+func Measure(representative *tlsh.TLSH, hashes []*tlsh.TLSH) (Spread, error) {
+	if len(hashes) == 0 {
+		return Spread{}, ErrEmpty
+	}
+	var (
+		s     Spread
+		total int
+	)
+	for _, h := range hashes {
+		if h == nil {
+			return Spread{}, ErrNilHash
+		}
+		d := representative.Diff(h)
+		total += d
+		if d > s.Radius {
+			s.Radius = d
+		}
+	}
+	s.MeanDistance = float64(total) / float64(len(hashes))
+	return s, nil
+}
@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/glaslos/tlsh"
+)
+
+func TestMedoid(t *testing.T) {
+	hashes := families(t, 10)
+	family := hashes[:10]
+	medoid, err := Medoid(family)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := func(i int) (s int) {
+		for _, h := range family {
+			s += family[i].Diff(h)
+		}
+		return s
+	}
+	for i := range family {
+		if sum(i) < sum(medoid) {
+			t.Errorf("\ndigest %d is closer to the others than medoid %d\n", i, medoid)
+		}
+	}
+	if m, err := Medoid(hashes[:1]); err != nil || m != 0 {
+		t.Errorf("\nexpected medoid 0, got %d (%v)\n", m, err)
+	}
+	if _, err := Medoid(nil); err != ErrEmpty {
+		t.Errorf("\nexpected %v, got %v\n", ErrEmpty, err)
+	}
+	if _, err := Medoid([]*tlsh.TLSH{nil}); err != ErrNilHash {
+		t.Errorf("\nexpected %v, got %v\n", ErrNilHash, err)
+	}
+}
+
+func TestConsensus(t *testing.T) {
+	hashes := families(t, 10)
+	family := hashes[10:20]
+	consensus, err := Consensus(family)
+	if err != nil {
+		t.Fatal(err)
+	}
+	medoid, _ := Medoid(family)
+	cs, err := Measure(consensus, family)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, _ := Measure(family[medoid], family)
+	if cs.MeanDistance > ms.MeanDistance || cs.Radius == 0 || cs.Radius < int(cs.MeanDistance) {
+		t.Errorf("\nconsensus spread %+v worse than medoid spread %+v\n", cs, ms)
+	}
+
+	// a single digest is its own consensus
+	if c, err := Consensus(hashes[:1]); err != nil || c.String() != hashes[0].String() {
+		t.Errorf("\nexpected %s, got %s (%v)\n", hashes[0], c, err)
+	}
+	if _, err := Consensus(nil); err != ErrEmpty {
+		t.Errorf("\nexpected %v, got %v\n", ErrEmpty, err)
+	}
+	if _, err := Measure(consensus, nil); err != ErrEmpty {
+		t.Errorf("\nexpected %v, got %v\n", ErrEmpty, err)
+	}
+	if s, err := Measure(hashes[0], hashes[:1]); err != nil || s.Radius != 0 || s.MeanDistance != 0 {
+		t.Errorf("\nunexpected spread %+v (%v)\n", s, err)
+	}
+}
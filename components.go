@@ -0,0 +1,108 @@
+package tlsh
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Checksum returns the one byte checksum of the digest
+func (t *TLSH) Checksum() byte {
+	return t.checksum
+}
+
+// LValue returns the log-scaled length bucket of the digest
+func (t *TLSH) LValue() byte {
+	return t.lValue
+}
+
+// LengthRange returns the smallest and largest input length in bytes that
+// map to the length bucket of the digest
+func (t *TLSH) LengthRange() (min, max int64) {
+	min, max, _ = LValueRange(t.lValue)
+	return min, max
+}
+
+// Q1Ratio returns the ratio of the first to the third quartile, modulo 16
+func (t *TLSH) Q1Ratio() byte {
+	return t.q1Ratio
+}
+
+// Q2Ratio returns the ratio of the second to the third quartile, modulo 16
+func (t *TLSH) Q2Ratio() byte {
+	return t.q2Ratio
+}
+
+// Body returns the 32 body bytes of the digest as in Binary
+func (t *TLSH) Body() [codeSize]byte {
+	return t.code
+}
+
+// Buckets returns the two-bit code of every one of the 128 buckets, from 0
+// for buckets up to the first quartile to 3 for buckets above the third
+func (t *TLSH) Buckets() [codeSize * 4]byte {
+	return bucketCodes(t.code)
+}
+
+// Describe returns a human readable summary of the digest header
+func (t *TLSH) Describe() string {
+	length := "unknown length"
+	if min, max, ok := LValueRange(t.lValue); ok {
+		length = fmt.Sprintf("%d-%d bytes", min, max)
+	}
+	return fmt.Sprintf("%s (lvalue %d), q1 ratio %d, q2 ratio %d, checksum 0x%02x",
+		length, t.lValue, t.q1Ratio, t.q2Ratio, t.checksum)
+}
+
+// FromComponents returns the digest made of the given components, e.g. as
+// read back from a custom storage layout. The quartile ratios must be below 16.
+func FromComponents(checksum, lValue, q1Ratio, q2Ratio byte, body [codeSize]byte) (*TLSH, error) {
+	if q1Ratio > 0xF || q2Ratio > 0xF {
+		return &TLSH{}, errors.New("quartile ratios must be below 16")
+	}
+	return new(checksum, lValue, q1Ratio, q2Ratio, q1Ratio<<4|q2Ratio, body, chunkState{}), nil
+}
+
+// maxLength bounds the search for lengths of a length bucket, its bucket
+// is above the largest bucket of 254
+const maxLength = 1 << 50
+
+// lValueRaw is lValue without the reduction modulo 255
+func lValueRaw(length int64) int {
+	switch {
+	case length <= 656:
+		return int(math.Floor(math.Log(float64(length)) / log1_5))
+	case length <= 3199:
+		return int(math.Floor(math.Log(float64(length))/log1_3 - 8.72777))
+	}
+	return int(math.Floor(math.Log(float64(length))/log1_1 - 62.5472))
+}
+
+// LValueRange returns the smallest and largest input length in bytes mapping
+// to the length bucket l, the inverse of the lValue header. Lengths beyond
+// about 13 TB wrap around to the lowest buckets and are ignored. It returns
+// false if no length maps to l.
+func LValueRange(l byte) (min, max int64, ok bool) {
+	if l == 255 {
+		// lValues are reduced modulo 255
+		return 0, 0, false
+	}
+	// firstLength is the smallest length with a raw bucket of at least l
+	firstLength := func(l int) int64 {
+		lo, hi := int64(1), int64(maxLength)
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			if lValueRaw(mid) >= l {
+				hi = mid
+			} else {
+				lo = mid + 1
+			}
+		}
+		return lo
+	}
+	min = firstLength(int(l))
+	if lValueRaw(min) != int(l) {
+		return 0, 0, false
+	}
+	return min, firstLength(int(l)+1) - 1, true
+}
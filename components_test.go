@@ -0,0 +1,60 @@
+package tlsh
+
+import "testing"
+
+func TestComponents(t *testing.T) {
+	for _, tc := range hashTestCases[:9] {
+		h, err := ParseStringToTlsh(tc.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := FromComponents(h.Checksum(), h.LValue(), h.Q1Ratio(), h.Q2Ratio(), h.Body())
+		if err != nil || c.String() != tc.hash || c.Diff(h) != 0 {
+			t.Errorf("\n%s\n%s - rebuilt from components doesn't match (%v)\n", tc.hash, c, err)
+		}
+		buckets := h.Buckets()
+		body := h.Body()
+		if buckets[0] != body[codeSize-1]&3 || buckets[127] != body[0]>>6 {
+			t.Errorf("\n%s: unexpected bucket codes %v\n", tc.filename, buckets)
+		}
+	}
+	if _, err := FromComponents(0, 0, 16, 0, [codeSize]byte{}); err == nil {
+		t.Error("missing error for invalid quartile ratio")
+	}
+}
+
+func TestLengthRange(t *testing.T) {
+	for _, tc := range hashTestCases[:9] {
+		h, err := HashFilename(tc.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		min, max := h.LengthRange()
+		if size := int64(h.state.fileSize); size < min || size > max {
+			t.Errorf("\n%s: length %d not in %d-%d\n", tc.filename, size, min, max)
+		}
+	}
+	for n := 1; n < 1<<22; n += n/7 + 1 {
+		min, max, ok := LValueRange(lValue(n))
+		if !ok || int64(n) < min || int64(n) > max || lValue(int(min)) != lValue(n) || lValue(int(max)) != lValue(n) {
+			t.Fatalf("\nlength %d not in %d-%d of bucket %d\n", n, min, max, lValue(n))
+		}
+	}
+	if min, max, ok := LValueRange(254); !ok || min <= 1<<40 || max >= maxLength {
+		t.Errorf("\nunexpected range %d-%d for the largest bucket\n", min, max)
+	}
+	if min, max, ok := LValueRange(255); ok {
+		t.Errorf("\nunexpected range %d-%d for bucket 255\n", min, max)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	h, err := HashFilename("tests/test_file_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "195-291 bytes (lvalue 13), q1 ratio 2, q2 ratio 2, checksum 0xe8"
+	if d := h.Describe(); d != expected {
+		t.Errorf("\nexpected %q, got %q\n", expected, d)
+	}
+}
@@ -0,0 +1,101 @@
+package tlsh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrLimitExceeded is returned when the input is larger than the size limit
+var ErrLimitExceeded = errors.New("input exceeds size limit")
+
+// HashReaderContext calculates the TLSH for the input reader like HashReader,
+// but stops once ctx is done or more than limit bytes are read. A limit of
+// zero or less reads until EOF.
+//
+// The context is checked between reads, a Read blocking forever is not
+// interrupted. If the limit is exceeded ErrLimitExceeded is returned along
+// with the hash of the first limit bytes, if those make a valid hash.
+func HashReaderContext(ctx context.Context, r io.Reader, limit int64) (*TLSH, error) {
+	cr := &contextReader{ctx: ctx, r: r, limit: limit}
+	s := chunkState{}
+	s.reset()
+	err := s.fillStream(cr)
+	switch {
+	case err == ErrLimitExceeded:
+		t, derr := digest(s.buckets, s.checksum, s.fileSize)
+		if derr != nil {
+			return &TLSH{state: t.state}, err
+		}
+		return t, err
+	case err != nil:
+		return &TLSH{}, err
+	}
+	t, err := digest(s.buckets, s.checksum, s.fileSize)
+	if err != nil {
+		return &TLSH{state: t.state}, err
+	}
+	return t, nil
+}
+
+// HashFilenameContext calculates the TLSH for the input file like
+// HashReaderContext. The file is closed once ctx is done, which interrupts
+// blocking reads from pipes and other pollable files.
+func HashFilenameContext(ctx context.Context, filename string, limit int64) (*TLSH, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return &TLSH{}, err
+	}
+	defer f.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.Close()
+		case <-done:
+		}
+	}()
+
+	t, err := HashReaderContext(ctx, f, limit)
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil && err != ErrLimitExceeded {
+		return &TLSH{}, ctxErr
+	}
+	return t, err
+}
+
+// contextReader stops reading once ctx is done or more than limit bytes are read
+type contextReader struct {
+	ctx   context.Context
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if c.limit > 0 {
+		if c.n >= c.limit {
+			return 0, c.exceeded()
+		}
+		if remaining := c.limit - c.n; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// exceeded returns ErrLimitExceeded if there is input beyond the limit
+func (c *contextReader) exceeded() error {
+	var b [1]byte
+	if _, err := io.ReadFull(c.r, b[:]); err != nil {
+		return err
+	}
+	return ErrLimitExceeded
+}
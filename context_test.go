@@ -0,0 +1,62 @@
+package tlsh
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+)
+
+func TestHashReaderContext(t *testing.T) {
+	blob, err := os.ReadFile("tests/test_file_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, _ := HashBytes(blob)
+	prefix, _ := HashBytes(blob[:200])
+
+	limitTestCases := []struct {
+		limit int64
+		hash  string
+		err   error
+	}{
+		{0, full.String(), nil},
+		{int64(len(blob)), full.String(), nil},
+		{int64(len(blob)) + 1, full.String(), nil},
+		{200, prefix.String(), ErrLimitExceeded},
+		{10, "0000000000000000000000000000000000000000000000000000000000000000000000", ErrLimitExceeded},
+		{3, "0000000000000000000000000000000000000000000000000000000000000000000000", ErrLimitExceeded},
+	}
+	for _, tc := range limitTestCases {
+		hash, err := HashReaderContext(context.Background(), bytes.NewReader(blob), tc.limit)
+		if err != tc.err || hash.String() != tc.hash {
+			t.Errorf("\nlimit %d: %s (%v) vs. %s (%v)\n", tc.limit, hash, err, tc.hash, tc.err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := HashReaderContext(ctx, bytes.NewReader(blob), 0); err != context.Canceled {
+		t.Errorf("\nexpected %v, got %v\n", context.Canceled, err)
+	}
+}
+
+func TestHashFilenameContext(t *testing.T) {
+	for _, tc := range hashTestCases {
+		if hash, err := HashFilenameContext(context.Background(), tc.filename, 0); hash.String() != tc.hash {
+			if err != nil {
+				t.Error(err)
+			}
+			t.Errorf("\nfilename: %s\n%s\n%s - doesn't match real hash\n", tc.filename, tc.hash, hash)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := HashFilenameContext(ctx, "tests/test_file_1", 0); err != context.Canceled {
+		t.Errorf("\nexpected %v, got %v\n", context.Canceled, err)
+	}
+	if _, err := HashFilenameContext(context.Background(), "tests/test_file_1", 100); err != ErrLimitExceeded {
+		t.Errorf("\nexpected %v, got %v\n", ErrLimitExceeded, err)
+	}
+}
@@ -0,0 +1,401 @@
+// Package db stores TLSH digests with an ID and metadata in a compact,
+// append-only file and answers threshold queries against them.
+//
+// The file starts with an 8 byte header, the magic "TLSHDB" followed by the
+// format version and a reserved byte. Each record follows as
+//
+//	digest   35 bytes, as returned by tlsh.TLSH.Binary
+//	idLen    uvarint
+//	id       idLen bytes
+//	metaLen  uvarint
+//	meta     metaLen bytes
+//
+// Records are only ever appended, so a database can be grown by Append while
+// readers load a consistent prefix of it. Open and Load ignore a partial
+// record at the end of the file left by a write in progress, Append cuts it
+// off before appending.
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/glaslos/tlsh"
+)
+
+const (
+	magic      = "TLSHDB"
+	version    = 1
+	headerSize = 8
+	digestSize = 35
+)
+
+var (
+	// ErrFormat is returned for files that are not a digest database
+	ErrFormat = errors.New("not a tlsh digest database")
+	// ErrVersion is returned for databases written by an unsupported version
+	ErrVersion = errors.New("unsupported tlsh digest database version")
+	// ErrCorrupt is returned for truncated or malformed records
+	ErrCorrupt = errors.New("corrupt tlsh digest database record")
+
+	// errPartial marks a record cut off by the end of the data
+	errPartial = errors.New("partial tlsh digest database record")
+)
+
+// Record is a single digest database entry
+type Record struct {
+	Hash *tlsh.TLSH
+	// ID identifies the sample, e.g. a path or a checksum
+	ID string
+	// Meta holds arbitrary data stored with the record
+	Meta []byte
+}
+
+func header() []byte {
+	return append([]byte(magic), version, 0)
+}
+
+func checkHeader(h []byte) error {
+	if len(h) < headerSize || string(h[:len(magic)]) != magic {
+		return ErrFormat
+	}
+	if h[len(magic)] != version {
+		return ErrVersion
+	}
+	return nil
+}
+
+// Writer appends records to a digest database
+type Writer struct {
+	w   *bufio.Writer
+	f   *os.File
+	buf [binary.MaxVarintLen64]byte
+}
+
+// NewWriter writes the database header to w and returns a Writer appending to it
+func NewWriter(w io.Writer) (*Writer, error) {
+	dw := &Writer{w: bufio.NewWriter(w)}
+	if _, err := dw.w.Write(header()); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+// Create creates or truncates the database filename
+func Create(filename string) (*Writer, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.f = f
+	return w, nil
+}
+
+// Append opens the database filename for appending, creating it if needed
+func Append(filename string) (*Writer, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	h := make([]byte, headerSize)
+	n, err := io.ReadFull(f, h)
+	switch {
+	case n == 0 && err == io.EOF:
+		w, err := NewWriter(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		w.f = f
+		return w, nil
+	case err == io.ErrUnexpectedEOF:
+		err = ErrFormat
+	case err == nil:
+		err = checkHeader(h)
+	}
+	if err == nil {
+		err = truncatePartial(f, filename)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Writer{w: bufio.NewWriter(f), f: f}, nil
+}
+
+// truncatePartial cuts a partial record at the end of the database off and
+// seeks to the end of the last complete record
+func truncatePartial(f *os.File, filename string) error {
+	data, unmap, err := mapFile(filename)
+	if err != nil {
+		return err
+	}
+	d, err := parse(data)
+	size, end := len(data), 0
+	if err == nil {
+		end = len(d.data)
+	}
+	unmap()
+	if err != nil {
+		return err
+	}
+	if end < size {
+		if err := f.Truncate(int64(end)); err != nil {
+			return err
+		}
+	}
+	_, err = f.Seek(int64(end), io.SeekStart)
+	return err
+}
+
+// Write appends a record
+func (w *Writer) Write(r Record) error {
+	if _, err := w.w.Write(r.Hash.Binary()); err != nil {
+		return err
+	}
+	if err := w.writeBytes([]byte(r.ID)); err != nil {
+		return err
+	}
+	return w.writeBytes(r.Meta)
+}
+
+func (w *Writer) writeBytes(b []byte) error {
+	n := binary.PutUvarint(w.buf[:], uint64(len(b)))
+	if _, err := w.w.Write(w.buf[:n]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Flush writes buffered records to the underlying writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Close flushes buffered records and closes the file opened by Create or Append
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if w.f != nil {
+		if cerr := w.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reader streams records from a digest database
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader checks the database header and returns a Reader for the records following it
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	h := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, h); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrFormat
+		}
+		return nil, err
+	}
+	if err := checkHeader(h); err != nil {
+		return nil, err
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record or io.EOF after the last one
+func (r *Reader) Next() (Record, error) {
+	digest := make([]byte, digestSize)
+	if _, err := io.ReadFull(r.r, digest); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Record{}, ErrCorrupt
+		}
+		return Record{}, err
+	}
+	h, err := tlsh.ParseBinaryToTlsh(digest)
+	if err != nil {
+		return Record{}, err
+	}
+	id, err := r.readBytes()
+	if err != nil {
+		return Record{}, err
+	}
+	meta, err := r.readBytes()
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Hash: h, ID: string(id), Meta: meta}, nil
+}
+
+func (r *Reader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, ErrCorrupt
+	}
+	return b, nil
+}
+
+// DB is a digest database loaded for querying. The digests are parsed into
+// memory, IDs and metadata are decoded from the file contents on demand.
+type DB struct {
+	data     []byte
+	offsets  []int
+	hashes   []*tlsh.TLSH
+	byLength [256][]int
+	unmap    func() error
+}
+
+// Open memory-maps the database filename where supported and reads it otherwise
+func Open(filename string) (*DB, error) {
+	data, unmap, err := mapFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	d, err := parse(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	d.unmap = unmap
+	return d, nil
+}
+
+// Load reads a database from r into memory
+func Load(r io.Reader) (*DB, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+// parse parses the complete records of data, a partial record at the end is
+// left out of the DB
+func parse(data []byte) (*DB, error) {
+	if err := checkHeader(data); err != nil {
+		return nil, err
+	}
+	d := &DB{}
+	off := headerSize
+	for off < len(data) {
+		next, err := recordEnd(data, off)
+		if err == errPartial {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		h, err := tlsh.ParseBinaryToTlsh(data[off : off+digestSize])
+		if err != nil {
+			return nil, err
+		}
+		l := h.LValue()
+		d.byLength[l] = append(d.byLength[l], len(d.hashes))
+		d.offsets = append(d.offsets, off)
+		d.hashes = append(d.hashes, h)
+		off = next
+	}
+	d.data = data[:off]
+	return d, nil
+}
+
+// recordEnd returns the offset after the record at off
+func recordEnd(data []byte, off int) (int, error) {
+	next := off + digestSize
+	if next > len(data) {
+		return 0, errPartial
+	}
+	for i := 0; i < 2; i++ {
+		n, l := binary.Uvarint(data[next:])
+		switch {
+		case l == 0:
+			return 0, errPartial
+		case l < 0:
+			return 0, ErrCorrupt
+		case uint64(len(data)-next-l) < n:
+			return 0, errPartial
+		}
+		next += l + int(n)
+	}
+	return next, nil
+}
+
+// Len returns the number of records
+func (d *DB) Len() int {
+	return len(d.hashes)
+}
+
+// Hash returns the digest of record i
+func (d *DB) Hash(i int) *tlsh.TLSH {
+	return d.hashes[i]
+}
+
+// Record returns record i
+func (d *DB) Record(i int) Record {
+	off := d.offsets[i] + digestSize
+	n, l := binary.Uvarint(d.data[off:])
+	off += l
+	id := string(d.data[off : off+int(n)])
+	off += int(n)
+	n, l = binary.Uvarint(d.data[off:])
+	off += l
+	meta := append([]byte(nil), d.data[off:off+int(n)]...)
+	return Record{Hash: d.hashes[i], ID: id, Meta: meta}
+}
+
+// QueryLinear compares t with every record and returns those within
+// threshold, sorted by distance
+func (d *DB) QueryLinear(t *tlsh.TLSH, threshold int) []tlsh.Match {
+	var matches []tlsh.Match
+	for i, h := range d.hashes {
+		if dist := t.Diff(h); dist <= threshold {
+			matches = append(matches, tlsh.Match{Index: i, Distance: dist})
+		}
+	}
+	tlsh.SortMatches(matches)
+	return matches
+}
+
+// Query returns the records within threshold of t, sorted by distance. Only
+// records whose length component alone stays within threshold are compared.
+func (d *DB) Query(t *tlsh.TLSH, threshold int) []tlsh.Match {
+	var matches []tlsh.Match
+	l := t.LValue()
+	for other := 0; other < len(d.byLength); other++ {
+		if tlsh.LengthDiff(l, byte(other)) > threshold {
+			continue
+		}
+		for _, i := range d.byLength[other] {
+			if dist := t.Diff(d.hashes[i]); dist <= threshold {
+				matches = append(matches, tlsh.Match{Index: i, Distance: dist})
+			}
+		}
+	}
+	tlsh.SortMatches(matches)
+	return matches
+}
+
+// Close releases the memory mapping of a database opened by Open
+func (d *DB) Close() error {
+	if d.unmap == nil {
+		return nil
+	}
+	err := d.unmap()
+	d.unmap = nil
+	d.data = nil
+	return err
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/glaslos/tlsh"
+)
+
+var testFiles = []string{
+	"../tests/test_file_1",
+	"../tests/test_file_2",
+	"../tests/test_file_3",
+	"../tests/test_file_4",
+	"../tests/test_file_5",
+	"../tests/test_file_6",
+	"../tests/test_file_7_lena.jpg",
+	"../tests/test_file_8_lena.png",
+	"../tests/test_file_9_tinyssl.exe",
+}
+
+func testRecords(t *testing.T) []Record {
+	var records []Record
+	for i, filename := range testFiles {
+		h, err := tlsh.HashFilename(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, Record{Hash: h, ID: filename, Meta: []byte(fmt.Sprintf(`{"n":%d}`, i))})
+	}
+	return records
+}
+
+func TestWriteOpen(t *testing.T) {
+	records := testRecords(t)
+	filename := filepath.Join(t.TempDir(), "test.tlshdb")
+
+	w, err := Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records[:4] {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = Append(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records[4:] {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if d.Len() != len(records) {
+		t.Fatalf("\nexpected %d records, got %d\n", len(records), d.Len())
+	}
+	for i, r := range records {
+		got := d.Record(i)
+		if got.ID != r.ID || !bytes.Equal(got.Meta, r.Meta) || got.Hash.String() != r.Hash.String() {
+			t.Errorf("\nrecord %d: %v vs. %v\n", i, got, r)
+		}
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dr, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		r, err := dr.Next()
+		if err == io.EOF {
+			if i != len(records) {
+				t.Errorf("\nexpected %d records, streamed %d\n", len(records), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ID != records[i].ID || r.Hash.String() != records[i].Hash.String() {
+			t.Errorf("\nstreamed record %d: %v vs. %v\n", i, r, records[i])
+		}
+	}
+}
+
+func TestPartialRecord(t *testing.T) {
+	records := testRecords(t)
+	filename := filepath.Join(t.TempDir(), "test.tlshdb")
+	w, err := Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records[:4] {
+		w.Write(r)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a reader sees the last record cut off by a flush in progress
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, data[:len(data)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Len() != 3 || d.Record(2).ID != records[2].ID {
+		t.Errorf("\nexpected the 3 complete records, got %d\n", d.Len())
+	}
+	d.Close()
+
+	if w, err = Append(filename); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records[3:] {
+		w.Write(r)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = Open(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if d.Len() != len(records) {
+		t.Fatalf("\nexpected %d records, got %d\n", len(records), d.Len())
+	}
+	for i, r := range records {
+		if got := d.Record(i); got.ID != r.ID || !bytes.Equal(got.Meta, r.Meta) || got.Hash.String() != r.Hash.String() {
+			t.Errorf("\nrecord %d: %v vs. %v\n", i, got, r)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	records := testRecords(t)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		w.Write(r)
+	}
+	w.Flush()
+
+	d, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, threshold := range []int{0, 50, 100, 300, 1000} {
+		for _, r := range records {
+			linear := d.QueryLinear(r.Hash, threshold)
+			indexed := d.Query(r.Hash, threshold)
+			if !reflect.DeepEqual(linear, indexed) {
+				t.Errorf("\nthreshold %d: linear %v vs. indexed %v\n", threshold, linear, indexed)
+			}
+			if len(indexed) == 0 || indexed[0].Distance != 0 || d.Record(indexed[0].Index).ID != r.ID {
+				t.Errorf("\n%s not found in database: %v\n", r.ID, indexed)
+			}
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	if _, err := Load(bytes.NewReader([]byte("NOTADB\x01\x00"))); err != ErrFormat {
+		t.Errorf("\nexpected %v, got %v\n", ErrFormat, err)
+	}
+	if _, err := Load(bytes.NewReader([]byte("TLSHDB\x09\x00"))); err != ErrVersion {
+		t.Errorf("\nexpected %v, got %v\n", ErrVersion, err)
+	}
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf)
+	w.Write(testRecords(t)[0])
+	w.Flush()
+	truncated := buf.Bytes()[:buf.Len()-1]
+	overflow := append(append([]byte(nil), buf.Bytes()[:headerSize+digestSize]...), bytes.Repeat([]byte{0xff}, 11)...)
+	if _, err := Load(bytes.NewReader(overflow)); err != ErrCorrupt {
+		t.Errorf("\nexpected %v, got %v\n", ErrCorrupt, err)
+	}
+	r, err := NewReader(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err != ErrCorrupt {
+		t.Errorf("\nexpected %v, got %v\n", ErrCorrupt, err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "bad.tlshdb")
+	os.WriteFile(filename, []byte("garbage!"), 0644)
+	if _, err := Append(filename); err != ErrFormat {
+		t.Errorf("\nexpected %v, got %v\n", ErrFormat, err)
+	}
+}
@@ -24,19 +24,21 @@ func digestDistance(x [codeSize]byte, y [codeSize]byte) (diff int) {
 	return
 }
 
+// LengthDiff is the distance of two lValues, the length component of Diff
+// and a lower bound of the distance of their digests
+func LengthDiff(a, b byte) int {
+	d := modDiff(a, b, 256)
+	if d <= 1 {
+		return d
+	}
+	return d * 12
+}
+
 // diffTotal calculates diff between two Tlsh hashes for hash header and body.
 func diffTotal(a, b *TLSH, lenDiff bool) int {
 	diff := 0
 	if lenDiff {
-		lDiff := modDiff(a.lValue, b.lValue, 256)
-
-		if lDiff == 0 {
-			diff = 0
-		} else if lDiff == 1 {
-			diff = 1
-		} else {
-			diff += lDiff * 12
-		}
+		diff = LengthDiff(a.lValue, b.lValue)
 	}
 
 	q1Diff := modDiff(a.q1Ratio, b.q1Ratio, 16)
@@ -53,7 +55,8 @@ func diffTotal(a, b *TLSH, lenDiff bool) int {
 		diff += (q2Diff - 1) * 12
 	}
 
-	// currently we only support 1 byte checksum
+	// the 1 byte checksum, tlsh-128-3 digests compare their other checksum
+	// bytes in their Distance
 	if a.checksum != b.checksum {
 		diff++
 	}
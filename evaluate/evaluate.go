@@ -0,0 +1,280 @@
+// Package evaluate measures how well TLSH distance thresholds separate
+// families of a labelled corpus
+package evaluate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/glaslos/tlsh"
+)
+
+// ErrNoFamilies is returned for a corpus without at least two hashed families
+var ErrNoFamilies = errors.New("corpus needs at least two families with hashed samples")
+
+// Sample is a hashed file of a family
+type Sample struct {
+	Family string
+	Path   string
+	Hash   *tlsh.TLSH
+}
+
+// Skipped is a file of the corpus that could not be hashed
+type Skipped struct {
+	Path string
+	Err  error
+}
+
+// Corpus is a set of samples labelled by family
+type Corpus struct {
+	Samples []Sample
+	Skipped []Skipped
+}
+
+// LoadDir hashes a labelled directory tree. Every subdirectory of dir is a
+// family holding the files found in it recursively. Files that cannot be
+// hashed, e.g. because they are too small, are recorded in Skipped.
+func LoadDir(dir string) (*Corpus, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := &Corpus{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		family := e.Name()
+		err := filepath.Walk(filepath.Join(dir, family), func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			hash, err := tlsh.HashFilename(path)
+			if err != nil {
+				c.Skipped = append(c.Skipped, Skipped{Path: path, Err: err})
+				return nil
+			}
+			c.Samples = append(c.Samples, Sample{Family: family, Path: path, Hash: hash})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Families returns the number of families with at least one sample
+func (c *Corpus) Families() int {
+	families := map[string]bool{}
+	for _, s := range c.Samples {
+		families[s.Family] = true
+	}
+	return len(families)
+}
+
+// Distances returns the distance of every pair of samples, labelled as same
+// family or different family pair
+func (c *Corpus) Distances() []tlsh.LabelledDistance {
+	var distances []tlsh.LabelledDistance
+	for i, a := range c.Samples {
+		for _, b := range c.Samples[i+1:] {
+			distances = append(distances, tlsh.LabelledDistance{
+				Distance: a.Hash.Diff(b.Hash),
+				Same:     a.Family == b.Family,
+			})
+		}
+	}
+	return distances
+}
+
+// Point is the outcome of matching all pairs within a distance threshold
+type Point struct {
+	Threshold      int     `json:"threshold"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	TrueNegatives  int     `json:"true_negatives"`
+	FalseNegatives int     `json:"false_negatives"`
+	TPR            float64 `json:"tpr"`
+	FPR            float64 `json:"fpr"`
+	Precision      float64 `json:"precision"`
+}
+
+// Recall is the true positive rate
+func (p Point) Recall() float64 {
+	return p.TPR
+}
+
+// point fills in the rates of the counts
+func point(threshold, tp, fp, same, different int) Point {
+	p := Point{
+		Threshold:      threshold,
+		TruePositives:  tp,
+		FalsePositives: fp,
+		TrueNegatives:  different - fp,
+		FalseNegatives: same - tp,
+		Precision:      1,
+	}
+	if same > 0 {
+		p.TPR = float64(tp) / float64(same)
+	}
+	if different > 0 {
+		p.FPR = float64(fp) / float64(different)
+	}
+	if tp+fp > 0 {
+		p.Precision = float64(tp) / float64(tp+fp)
+	}
+	return p
+}
+
+// Curve returns the ROC and precision/recall curve of the distances with a
+// point for every distinct distance, by increasing threshold
+func Curve(distances []tlsh.LabelledDistance) []Point {
+	sorted := append([]tlsh.LabelledDistance(nil), distances...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Distance < sorted[j].Distance })
+	same, different := count(sorted)
+
+	var curve []Point
+	tp, fp := 0, 0
+	for i, d := range sorted {
+		if d.Same {
+			tp++
+		} else {
+			fp++
+		}
+		if i+1 < len(sorted) && sorted[i+1].Distance == d.Distance {
+			continue
+		}
+		curve = append(curve, point(d.Distance, tp, fp, same, different))
+	}
+	return curve
+}
+
+// At returns the points at the given thresholds
+func At(distances []tlsh.LabelledDistance, thresholds []int) []Point {
+	same, different := count(distances)
+	points := make([]Point, len(thresholds))
+	for i, t := range thresholds {
+		tp, fp := 0, 0
+		for _, d := range distances {
+			if d.Distance > t {
+				continue
+			}
+			if d.Same {
+				tp++
+			} else {
+				fp++
+			}
+		}
+		points[i] = point(t, tp, fp, same, different)
+	}
+	return points
+}
+
+// Best returns the point of the curve with the highest true positive rate
+// and a false positive rate of at most targetFPR. It returns false if no
+// point meets the target.
+func Best(curve []Point, targetFPR float64) (Point, bool) {
+	var (
+		best  Point
+		found bool
+	)
+	for _, p := range curve {
+		if p.FPR <= targetFPR && (!found || p.TPR > best.TPR) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+func count(distances []tlsh.LabelledDistance) (same, different int) {
+	for _, d := range distances {
+		if d.Same {
+			same++
+		} else {
+			different++
+		}
+	}
+	return same, different
+}
+
+// Report summarises the evaluation of a corpus
+type Report struct {
+	Samples        int     `json:"samples"`
+	Skipped        int     `json:"skipped"`
+	Families       int     `json:"families"`
+	SamePairs      int     `json:"same_pairs"`
+	DifferentPairs int     `json:"different_pairs"`
+	Curve          []Point `json:"curve"`
+	Thresholds     []Point `json:"thresholds"`
+	TargetFPR      float64 `json:"target_fpr"`
+	// Best is nil if no threshold meets TargetFPR
+	Best *Point `json:"best"`
+}
+
+// Evaluate computes the curve of the corpus, the points at the thresholds
+// and the best threshold for targetFPR
+func Evaluate(c *Corpus, thresholds []int, targetFPR float64) (*Report, error) {
+	if c.Families() < 2 {
+		return nil, ErrNoFamilies
+	}
+	distances := c.Distances()
+	r := &Report{
+		Samples:    len(c.Samples),
+		Skipped:    len(c.Skipped),
+		Families:   c.Families(),
+		Curve:      Curve(distances),
+		Thresholds: At(distances, thresholds),
+		TargetFPR:  targetFPR,
+	}
+	r.SamePairs, r.DifferentPairs = count(distances)
+	if best, ok := Best(r.Curve, targetFPR); ok {
+		r.Best = &best
+	}
+	return r, nil
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the curve, the requested thresholds and the best threshold
+// as CSV with a header row. The kind column tells the rows apart, it is
+// curve, threshold or best.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"kind", "threshold", "tp", "fp", "tn", "fn", "tpr", "fpr", "precision"})
+	row := func(kind string, p Point) {
+		cw.Write([]string{
+			kind,
+			strconv.Itoa(p.Threshold),
+			strconv.Itoa(p.TruePositives),
+			strconv.Itoa(p.FalsePositives),
+			strconv.Itoa(p.TrueNegatives),
+			strconv.Itoa(p.FalseNegatives),
+			strconv.FormatFloat(p.TPR, 'f', 6, 64),
+			strconv.FormatFloat(p.FPR, 'f', 6, 64),
+			strconv.FormatFloat(p.Precision, 'f', 6, 64),
+		})
+	}
+	for _, p := range r.Curve {
+		row("curve", p)
+	}
+	for _, p := range r.Thresholds {
+		row("threshold", p)
+	}
+	if r.Best != nil {
+		row("best", *r.Best)
+	}
+	cw.Flush()
+	return cw.Error()
+}
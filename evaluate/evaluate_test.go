@@ -0,0 +1,148 @@
+package evaluate
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glaslos/tlsh"
+)
+
+// writeCorpus writes families of mutated copies of test files and a file too
+// small to hash
+func writeCorpus(tb testing.TB) string {
+	dir := tb.TempDir()
+	r := rand.New(rand.NewSource(1))
+	families := map[string]string{
+		"text": "../tests/test_file_3",
+		"exe":  "../tests/test_file_9_tinyssl.exe",
+		"jpg":  "../tests/test_file_7_lena.jpg",
+	}
+	for family, filename := range families {
+		blob, err := os.ReadFile(filename)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, family, "nested"), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		for i := 0; i < 4; i++ {
+			b := append([]byte(nil), blob...)
+			for j := 0; j < 10*i; j++ {
+				b[r.Intn(len(b))] = byte(r.Intn(256))
+			}
+			sub := ""
+			if i%2 == 1 {
+				sub = "nested"
+			}
+			name := filepath.Join(dir, family, sub, "sample"+string(rune('a'+i)))
+			if err := os.WriteFile(name, b, 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "text", "small"), []byte("too small"), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadDir(t *testing.T) {
+	c, err := LoadDir(writeCorpus(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Samples) != 12 || len(c.Skipped) != 1 || c.Families() != 3 {
+		t.Errorf("\nunexpected corpus: %d samples, %d skipped, %d families\n", len(c.Samples), len(c.Skipped), c.Families())
+	}
+	if d := c.Distances(); len(d) != 66 {
+		t.Errorf("\nexpected 66 pairs, got %d\n", len(d))
+	}
+	if _, err := LoadDir("../tests/NON_EXISTENT"); err == nil {
+		t.Error("missing error for non existent directory")
+	}
+}
+
+func TestCurve(t *testing.T) {
+	distances := []tlsh.LabelledDistance{
+		{Distance: 10, Same: true},
+		{Distance: 20, Same: true},
+		{Distance: 20, Same: false},
+		{Distance: 80, Same: true},
+		{Distance: 200, Same: false},
+	}
+	curve := Curve(distances)
+	expected := []Point{
+		{Threshold: 10, TruePositives: 1, TrueNegatives: 2, FalseNegatives: 2, TPR: 1.0 / 3, Precision: 1},
+		{Threshold: 20, TruePositives: 2, FalsePositives: 1, TrueNegatives: 1, FalseNegatives: 1, TPR: 2.0 / 3, FPR: 0.5, Precision: 2.0 / 3},
+		{Threshold: 80, TruePositives: 3, FalsePositives: 1, TrueNegatives: 1, TPR: 1, FPR: 0.5, Precision: 0.75},
+		{Threshold: 200, TruePositives: 3, FalsePositives: 2, TPR: 1, FPR: 1, Precision: 0.6},
+	}
+	if len(curve) != len(expected) {
+		t.Fatalf("\nexpected %d points, got %d\n", len(expected), len(curve))
+	}
+	for i, p := range curve {
+		if p != expected[i] {
+			t.Errorf("\npoint %d: expected %+v, got %+v\n", i, expected[i], p)
+		}
+	}
+
+	at := At(distances, []int{0, 20, 100})
+	if at[0].TruePositives != 0 || at[0].Precision != 1 || at[1] != curve[1] || at[2].Threshold != 100 || at[2].TPR != 1 {
+		t.Errorf("\nunexpected points %+v\n", at)
+	}
+
+	if best, ok := Best(curve, 0.5); !ok || best.Threshold != 80 {
+		t.Errorf("\nexpected best threshold 80, got %+v\n", best)
+	}
+	if best, ok := Best(curve, 0); !ok || best.Threshold != 10 {
+		t.Errorf("\nexpected best threshold 10, got %+v\n", best)
+	}
+	if _, ok := Best(curve[1:], 0.1); ok {
+		t.Error("unexpected best threshold")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	c, err := LoadDir(writeCorpus(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Evaluate(c, []int{30, 50, 100}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SamePairs != 18 || r.DifferentPairs != 48 || len(r.Thresholds) != 3 {
+		t.Errorf("\nunexpected report %+v\n", r)
+	}
+	if r.Best == nil || r.Best.TPR != 1 || r.Best.FPR != 0 {
+		t.Errorf("\nexpected perfect separation, got %+v\n", r.Best)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Curve) != len(r.Curve) {
+		t.Errorf("\ncould not decode report: %v\n", err)
+	}
+
+	buf.Reset()
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(r.Curve)+len(r.Thresholds)+2 || !strings.HasPrefix(lines[0], "kind,threshold,") ||
+		!strings.HasPrefix(lines[len(lines)-1], "best,") {
+		t.Errorf("\nunexpected csv:\n%s\n", buf.String())
+	}
+
+	if _, err := Evaluate(&Corpus{Samples: c.Samples[:1]}, nil, 0); err != ErrNoFamilies {
+		t.Errorf("\nexpected %v, got %v\n", ErrNoFamilies, err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package exe calculates TLSH digests over the individual sections of
+// ELF, PE and Mach-O executables.
+//
+// A whole-file digest of an executable is dominated by padding, resources
+// and linker artefacts. Hashing each section separately, and all code
+// sections together, gives digests that track the parts of the binary
+// reverse engineers actually care about.
+package exe
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/glaslos/tlsh"
+)
+
+// Executable formats reported in Result.Format
+const (
+	FormatELF   = "elf"
+	FormatPE    = "pe"
+	FormatMachO = "macho"
+)
+
+// ErrUnknownFormat is returned when the input is not an ELF, PE or Mach-O file
+var ErrUnknownFormat = errors.New("unknown executable format")
+
+// Mach-O section attributes and types, see <mach-o/loader.h>
+const (
+	machoSectionType          = 0x000000ff
+	machoZerofill             = 0x1
+	machoGBZerofill           = 0xc
+	machoThreadLocalZerofill  = 0x12
+	machoAttrPureInstructions = 0x80000000
+	machoAttrSomeInstructions = 0x00000400
+)
+
+// PE section characteristics, see winnt.h
+const (
+	peSectionCode    = 0x00000020
+	peSectionExecute = 0x20000000
+)
+
+// Section holds the digest of a single section or segment
+type Section struct {
+	// Name of the section, Mach-O sections are named "segment,section"
+	Name string
+	// Offset of the section data in the file
+	Offset uint64
+	// Size of the section data in the file
+	Size uint64
+	// Code is set for sections containing executable instructions
+	Code bool
+	// Hash is nil if the section could not be hashed, see Err
+	Hash *tlsh.TLSH
+	// Err is set if the section could not be hashed, e.g. it is too small
+	Err error
+}
+
+// Result holds the per-section digests of an executable
+type Result struct {
+	// Format is one of FormatELF, FormatPE or FormatMachO
+	Format string
+	// Sections lists all sections with data in the file, in section header order
+	Sections []Section
+	// Code is the digest over all code sections concatenated, nil if there
+	// is no code or it could not be hashed, see CodeErr
+	Code *tlsh.TLSH
+	// CodeErr is set if the code digest could not be calculated
+	CodeErr error
+}
+
+// HashFilename calculates the section digests for the input file
+func HashFilename(filename string) (*Result, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Hash(f)
+}
+
+// Hash calculates the section digests for the input executable
+func Hash(r io.ReaderAt) (*Result, error) {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		if err == io.EOF {
+			return nil, ErrUnknownFormat
+		}
+		return nil, err
+	}
+
+	var (
+		res *Result
+		err error
+	)
+	switch {
+	case string(magic[:]) == elf.ELFMAG:
+		res, err = elfSections(r)
+	case magic[0] == 'M' && magic[1] == 'Z':
+		res, err = peSections(r)
+	case isMachO(magic):
+		res, err = machoSections(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var code []io.Reader
+	for i := range res.Sections {
+		s := &res.Sections[i]
+		s.Hash, s.Err = hash(io.NewSectionReader(r, int64(s.Offset), int64(s.Size)))
+		if s.Code {
+			code = append(code, io.NewSectionReader(r, int64(s.Offset), int64(s.Size)))
+		}
+	}
+	if len(code) == 0 {
+		res.CodeErr = errors.New("no code sections")
+		return res, nil
+	}
+	res.Code, res.CodeErr = hash(io.MultiReader(code...))
+	return res, nil
+}
+
+func hash(r io.Reader) (*tlsh.TLSH, error) {
+	t, err := tlsh.HashReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func isMachO(magic [4]byte) bool {
+	m := binary.LittleEndian.Uint32(magic[:])
+	switch m {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	m = binary.BigEndian.Uint32(magic[:])
+	return m == macho.Magic32 || m == macho.Magic64
+}
+
+func newSection(name string, offset, size uint64, code bool) Section {
+	return Section{
+		Name:   name,
+		Offset: offset,
+		Size:   size,
+		Code:   code,
+	}
+}
+
+func elfSections(r io.ReaderAt) (*Result, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := &Result{Format: FormatELF}
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NOBITS || s.Type == elf.SHT_NULL || s.Size == 0 {
+			continue
+		}
+		res.Sections = append(res.Sections,
+			newSection(s.Name, s.Offset, s.Size, s.Flags&elf.SHF_EXECINSTR != 0))
+	}
+	if len(res.Sections) > 0 {
+		return res, nil
+	}
+
+	// stripped section headers, fall back to the loadable segments
+	for i, p := range f.Progs {
+		if p.Type != elf.PT_LOAD || p.Filesz == 0 {
+			continue
+		}
+		res.Sections = append(res.Sections,
+			newSection(fmt.Sprintf("LOAD[%d]", i), p.Off, p.Filesz, p.Flags&elf.PF_X != 0))
+	}
+	return res, nil
+}
+
+func peSections(r io.ReaderAt) (*Result, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := &Result{Format: FormatPE}
+	for _, s := range f.Sections {
+		if s.Size == 0 || s.Offset == 0 {
+			continue
+		}
+		code := s.Characteristics&(peSectionCode|peSectionExecute) != 0
+		res.Sections = append(res.Sections,
+			newSection(s.Name, uint64(s.Offset), uint64(s.Size), code))
+	}
+	return res, nil
+}
+
+func machoSections(r io.ReaderAt) (*Result, error) {
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := &Result{Format: FormatMachO}
+	for _, s := range f.Sections {
+		switch s.Flags & machoSectionType {
+		case machoZerofill, machoGBZerofill, machoThreadLocalZerofill:
+			continue
+		}
+		if s.Size == 0 || s.Offset == 0 {
+			continue
+		}
+		code := s.Flags&(machoAttrPureInstructions|machoAttrSomeInstructions) != 0
+		res.Sections = append(res.Sections,
+			newSection(s.Seg+","+s.Name, uint64(s.Offset), s.Size, code))
+	}
+	return res, nil
+}
@@ -0,0 +1,104 @@
+package exe
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestHashFilenamePE(t *testing.T) {
+	res, err := HashFilename("../tests/test_file_9_tinyssl.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Format != FormatPE {
+		t.Errorf("\nwrong format %s vs. %s\n", res.Format, FormatPE)
+	}
+
+	sectionTestCases := []struct {
+		name   string
+		offset uint64
+		size   uint64
+		code   bool
+	}{
+		{".text", 1024, 69632, true},
+		{".itext", 70656, 512, true},
+		{".data", 71168, 7168, false},
+		{".rsrc", 87552, 512, false},
+	}
+	for _, tc := range sectionTestCases {
+		var found bool
+		for _, s := range res.Sections {
+			if s.Name != tc.name {
+				continue
+			}
+			found = true
+			if s.Offset != tc.offset || s.Size != tc.size || s.Code != tc.code {
+				t.Errorf("\nsection %s: got offset %d size %d code %t\n", s.Name, s.Offset, s.Size, s.Code)
+			}
+			if s.Hash == nil && s.Err == nil {
+				t.Errorf("\nsection %s has neither hash nor error\n", s.Name)
+			}
+		}
+		if !found {
+			t.Errorf("\nsection %s missing\n", tc.name)
+		}
+	}
+
+	for _, s := range res.Sections {
+		if s.Name == ".bss" || s.Name == ".tls" {
+			t.Errorf("\nsection %s without file data should be skipped\n", s.Name)
+		}
+	}
+
+	if res.Code == nil {
+		t.Fatal(res.CodeErr)
+	}
+	for _, s := range res.Sections {
+		if s.Name == ".text" && res.Code.Diff(s.Hash) > 50 {
+			t.Errorf("\ncode digest too far from .text digest: %d\n", res.Code.Diff(s.Hash))
+		}
+	}
+}
+
+func TestHashFilenameSelf(t *testing.T) {
+	formats := map[string]string{
+		"linux":   FormatELF,
+		"freebsd": FormatELF,
+		"windows": FormatPE,
+		"darwin":  FormatMachO,
+	}
+	format, ok := formats[runtime.GOOS]
+	if !ok {
+		t.Skipf("no executable format known for %s", runtime.GOOS)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	res, err := HashFilename(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Format != format {
+		t.Errorf("\nwrong format %s vs. %s\n", res.Format, format)
+	}
+	if res.Code == nil {
+		t.Error(res.CodeErr)
+	}
+}
+
+func TestHashFilenameUnknown(t *testing.T) {
+	for _, filename := range []string{"../tests/test_file_1", "../tests/test_file_49bytes"} {
+		if _, err := HashFilename(filename); err != ErrUnknownFormat {
+			t.Errorf("\n%s: expected %v, got %v\n", filename, ErrUnknownFormat, err)
+		}
+	}
+	if _, err := Hash(bytes.NewReader(nil)); err != ErrUnknownFormat {
+		t.Errorf("\nempty input: expected %v, got %v\n", ErrUnknownFormat, err)
+	}
+	if _, err := HashFilename("../tests/NON_EXISTENT"); err == nil {
+		t.Error("missing error for non existent file")
+	}
+}
@@ -51,26 +51,6 @@ func (t *TLSH) Sum(b []byte) []byte {
 }
 
 func (t *TLSH) Write(p []byte) (int, error) {
-	t.state.fileSize += len(p)
-	if len(t.state.chunkSlice) < windowLength {
-		missing := windowLength - len(t.state.chunkSlice)
-		switch {
-		case len(p) < missing:
-			t.state.chunkSlice = append(t.state.chunkSlice, p...)
-			return len(p), nil
-		default:
-			t.state.chunkSlice = append(t.state.chunkSlice, p[0:missing]...)
-			p = p[missing:]
-			copy(t.state.chunk[:], t.state.chunkSlice[0:5])
-			t.state.chunk = reverse(t.state.chunk)
-			t.state.process()
-		}
-	}
-
-	for _, b := range p {
-		t.state.chunk[0] = b
-		t.state.process()
-	}
-
+	t.state.update(p)
 	return len(p), nil
 }
@@ -0,0 +1,112 @@
+package tlsh
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// gridColumns is the number of buckets per row of a rendered digest
+const gridColumns = 16
+
+var (
+	// bucketPalette colours the bucket codes 0 to 3
+	bucketPalette = color.Palette{
+		color.RGBA{0xf7, 0xfb, 0xff, 0xff},
+		color.RGBA{0x9e, 0xca, 0xe1, 0xff},
+		color.RGBA{0x31, 0x82, 0xbd, 0xff},
+		color.RGBA{0x08, 0x30, 0x6b, 0xff},
+	}
+	// diffPalette colours the bucket distances 0 to 6
+	diffPalette = color.Palette{
+		color.RGBA{0xff, 0xff, 0xff, 0xff},
+		color.RGBA{0xfe, 0xe0, 0xd2, 0xff},
+		color.RGBA{0xfc, 0xbb, 0xa1, 0xff},
+		color.RGBA{0xfc, 0x92, 0x72, 0xff},
+		color.RGBA{0xfb, 0x6a, 0x4a, 0xff},
+		color.RGBA{0xde, 0x2d, 0x26, 0xff},
+		color.RGBA{0xa5, 0x0f, 0x15, 0xff},
+	}
+)
+
+// bucketCodes returns the two-bit code of every bucket of the digest body
+func bucketCodes(code [codeSize]byte) [codeSize * 4]byte {
+	var codes [codeSize * 4]byte
+	for i := range codes {
+		codes[i] = code[codeSize-1-i/4] >> uint(2*(i%4)) & 3
+	}
+	return codes
+}
+
+// bucketDiffs returns the distance of every bucket of two digest bodies as
+// weighted by bitPairsDiffTable
+func bucketDiffs(a, b [codeSize]byte) [codeSize * 4]byte {
+	var diffs [codeSize * 4]byte
+	for i := range diffs {
+		shift := uint(2 * (i % 4))
+		x := a[codeSize-1-i/4] & (3 << shift)
+		y := b[codeSize-1-i/4] & (3 << shift)
+		diffs[i] = byte(bitPairsDiffTable[x][y])
+	}
+	return diffs
+}
+
+// renderGrid draws the values as a grid of cell sized squares
+func renderGrid(values [codeSize * 4]byte, palette color.Palette, cell int) *image.Paletted {
+	if cell < 1 {
+		cell = 1
+	}
+	rows := len(values) / gridColumns
+	img := image.NewPaletted(image.Rect(0, 0, gridColumns*cell, rows*cell), palette)
+	for i, v := range values {
+		x0, y0 := i%gridColumns*cell, i/gridColumns*cell
+		for y := y0; y < y0+cell; y++ {
+			for x := x0; x < x0+cell; x++ {
+				img.SetColorIndex(x, y, v)
+			}
+		}
+	}
+	return img
+}
+
+// writeGridSVG writes the values as an SVG grid of cell sized squares
+func writeGridSVG(w io.Writer, values [codeSize * 4]byte, palette color.Palette, cell int) error {
+	if cell < 1 {
+		cell = 1
+	}
+	bw := bufio.NewWriter(w)
+	width, height := gridColumns*cell, len(values)/gridColumns*cell
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+	for i, v := range values {
+		r, g, b, _ := palette[v].RGBA()
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="#%02x%02x%02x"><title>bucket %d: %d</title></rect>`+"\n",
+			i%gridColumns*cell, i/gridColumns*cell, cell, cell, r>>8, g>>8, b>>8, i, v)
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// Image renders the 128 bucket codes of the digest as a 16x8 grid of cell
+// sized squares, darker for higher codes. Encode it with image/png.
+func (t *TLSH) Image(cell int) image.Image {
+	return renderGrid(bucketCodes(t.code), bucketPalette, cell)
+}
+
+// WriteSVG writes the grid of Image as SVG
+func (t *TLSH) WriteSVG(w io.Writer, cell int) error {
+	return writeGridSVG(w, bucketCodes(t.code), bucketPalette, cell)
+}
+
+// DiffImage renders the distance between the buckets of two digests as a
+// 16x8 grid of cell sized squares, white for equal buckets and darker red
+// for buckets adding more to the distance
+func DiffImage(a, b *TLSH, cell int) image.Image {
+	return renderGrid(bucketDiffs(a.code, b.code), diffPalette, cell)
+}
+
+// WriteDiffSVG writes the grid of DiffImage as SVG
+func WriteDiffSVG(w io.Writer, a, b *TLSH, cell int) error {
+	return writeGridSVG(w, bucketDiffs(a.code, b.code), diffPalette, cell)
+}
@@ -0,0 +1,55 @@
+package tlsh
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestImage(t *testing.T) {
+	a, _ := HashFilename("tests/test_file_1")
+	b, _ := HashFilename("tests/test_file_2")
+
+	var codes [numBuckets]uint
+	for i, c := range bucketCodes(a.code) {
+		codes[i] = uint(c)
+	}
+	if bucketsBinaryRepresentation(codes, 0, 1, 2) != a.code {
+		t.Error("bucket codes do not match the digest body")
+	}
+	total := 0
+	for _, d := range bucketDiffs(a.code, b.code) {
+		total += int(d)
+	}
+	if total != digestDistance(a.code, b.code) {
+		t.Errorf("\nbucket distances add up to %d instead of %d\n", total, digestDistance(a.code, b.code))
+	}
+
+	img := a.Image(4)
+	if bounds := img.Bounds(); bounds.Dx() != 64 || bounds.Dy() != 32 {
+		t.Errorf("\nunexpected image size %v\n", bounds)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, DiffImage(a, b, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := png.Decode(&buf); err != nil || decoded.Bounds().Dx() != 16 {
+		t.Errorf("\ncould not decode diff image (%v)\n", err)
+	}
+	if r, g, b, _ := DiffImage(a, a, 1).At(5, 5).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Error("equal buckets are not white")
+	}
+
+	buf.Reset()
+	if err := a.WriteSVG(&buf, 10); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "<rect"); n != 128 || !strings.HasPrefix(buf.String(), "<svg") {
+		t.Errorf("\nunexpected svg with %d buckets\n", n)
+	}
+	buf.Reset()
+	if err := WriteDiffSVG(&buf, a, b, 10); err != nil || !strings.Contains(buf.String(), `width="160" height="80"`) {
+		t.Errorf("\nunexpected diff svg (%v)\n", err)
+	}
+}
@@ -0,0 +1,548 @@
+// Package normalize removes trivial differences from text before it is hashed.
+//
+// Line endings, indentation, letter case or comments in scripts, markup and
+// configuration files shift TLSH distances more than analysts expect. Reader
+// wraps an io.Reader and applies a configurable set of normalisations while
+// streaming, so its output can be fed directly to tlsh.HashReader.
+//
+// Input that is not valid UTF-8 is passed through byte by byte.
+package normalize
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/glaslos/tlsh"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization is a set of normalisations applied to the input
+type Normalization uint
+
+const (
+	// LineEndings converts CRLF and CR line endings to LF
+	LineEndings Normalization = 1 << iota
+	// Comments strips the comments of Options.Language
+	Comments
+	// NFC converts the text to Unicode Normalization Form C, so canonically
+	// equivalent text is identical
+	NFC
+	// CaseFold converts all letters to lower case
+	CaseFold
+	// Whitespace strips indentation, trailing blanks and empty lines and
+	// collapses all other runs of blanks into a single space
+	Whitespace
+
+	// None disables all normalisations
+	None Normalization = 0
+	// All enables all normalisations
+	All = LineEndings | Comments | NFC | CaseFold | Whitespace
+)
+
+var normalizationNames = []struct {
+	n    Normalization
+	name string
+}{
+	{LineEndings, "line-endings"},
+	{Comments, "comments"},
+	{NFC, "nfc"},
+	{CaseFold, "case-fold"},
+	{Whitespace, "whitespace"},
+}
+
+// String returns the comma separated names of the normalisations in n
+func (n Normalization) String() string {
+	var names []string
+	for _, nn := range normalizationNames {
+		if n&nn.n != 0 {
+			names = append(names, nn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// Language selects the comment syntax stripped by Comments
+type Language int
+
+const (
+	// LanguageNone has no comments
+	LanguageNone Language = iota
+	// LanguageC has // and /* */ comments, e.g. C, Go, Java or JavaScript
+	LanguageC
+	// LanguageShell has # comments, e.g. shell, Python, Ruby or YAML
+	LanguageShell
+	// LanguageSQL has -- and /* */ comments
+	LanguageSQL
+	// LanguageHTML has <!-- --> comments, e.g. HTML or XML
+	LanguageHTML
+	// LanguageINI has ; and # comments
+	LanguageINI
+)
+
+type syntax struct {
+	line   []string
+	block  [][2]string
+	quotes string
+}
+
+var syntaxes = map[Language]syntax{
+	LanguageC:     {line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: "\"'`"},
+	LanguageShell: {line: []string{"#"}, quotes: "\"'"},
+	LanguageSQL:   {line: []string{"--"}, block: [][2]string{{"/*", "*/"}}, quotes: "'"},
+	LanguageHTML:  {block: [][2]string{{"<!--", "-->"}}},
+	LanguageINI:   {line: []string{";", "#"}},
+}
+
+var extensions = map[string]Language{
+	".c": LanguageC, ".h": LanguageC, ".cc": LanguageC, ".cpp": LanguageC, ".hpp": LanguageC,
+	".cs": LanguageC, ".go": LanguageC, ".java": LanguageC, ".js": LanguageC, ".ts": LanguageC,
+	".kt": LanguageC, ".rs": LanguageC, ".swift": LanguageC, ".scala": LanguageC,
+	".sh": LanguageShell, ".bash": LanguageShell, ".zsh": LanguageShell, ".py": LanguageShell,
+	".rb": LanguageShell, ".pl": LanguageShell, ".ps1": LanguageShell, ".r": LanguageShell,
+	".yaml": LanguageShell, ".yml": LanguageShell, ".toml": LanguageShell, ".sql": LanguageSQL,
+	".html": LanguageHTML, ".htm": LanguageHTML, ".xhtml": LanguageHTML, ".xml": LanguageHTML,
+	".svg": LanguageHTML,
+	".ini": LanguageINI, ".cfg": LanguageINI, ".conf": LanguageINI, ".inf": LanguageINI,
+}
+
+// LanguageFromFilename guesses the comment syntax from the file extension
+func LanguageFromFilename(filename string) Language {
+	return extensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// Options configures a Reader
+type Options struct {
+	// Normalizations to apply
+	Normalizations Normalization
+	// Language of the input, used by Comments
+	Language Language
+}
+
+const fillRunes = 4096
+
+// Reader normalises the text read from an underlying reader
+type Reader struct {
+	src     *bufio.Reader
+	out     []byte
+	pos     int
+	err     error
+	first   stage
+	applied Normalization
+	buf     [utf8.UTFMax]byte
+}
+
+// NewReader returns a Reader applying opts to the text read from r
+func NewReader(r io.Reader, opts Options) *Reader {
+	nr := &Reader{src: bufio.NewReader(r)}
+
+	var s stage = &sink{r: nr}
+	n := opts.Normalizations
+	if n&Whitespace != 0 {
+		s = &whitespace{next: s, r: nr, lineStart: true}
+	}
+	if n&CaseFold != 0 {
+		s = &caseFold{next: s, r: nr}
+	}
+	if n&NFC != 0 {
+		s = &nfc{next: s, r: nr}
+	}
+	if sx, ok := syntaxes[opts.Language]; ok && n&Comments != 0 {
+		s = &comments{next: s, r: nr, syntax: sx}
+	}
+	if n&LineEndings != 0 {
+		s = &lineEndings{next: s, r: nr}
+	}
+	nr.first = s
+	return nr
+}
+
+// Applied returns the normalisations that changed the input read so far
+func (r *Reader) Applied() Normalization {
+	return r.applied
+}
+
+// Read reads normalised text into p
+func (r *Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		r.fill()
+		if r.pos == len(r.out) {
+			break
+		}
+		m := copy(p[n:], r.out[r.pos:])
+		r.pos += m
+		n += m
+	}
+	if n == 0 && len(p) > 0 {
+		return 0, r.err
+	}
+	return n, nil
+}
+
+// ReadByte reads a single byte of normalised text
+func (r *Reader) ReadByte() (byte, error) {
+	r.fill()
+	if r.pos == len(r.out) {
+		return 0, r.err
+	}
+	b := r.out[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// fill pushes input through the stages until output is available or the input is exhausted
+func (r *Reader) fill() {
+	for r.pos == len(r.out) && r.err == nil {
+		r.out, r.pos = r.out[:0], 0
+		for i := 0; i < fillRunes; i++ {
+			c, size, err := r.src.ReadRune()
+			if err != nil {
+				r.err = err
+				if err == io.EOF {
+					r.first.flush()
+				}
+				break
+			}
+			if c == utf8.RuneError && size == 1 {
+				r.src.UnreadRune()
+				b, _ := r.src.ReadByte()
+				c = rawByte(b)
+			}
+			r.first.push(c)
+		}
+	}
+}
+
+// rawByte represents a byte that is not valid UTF-8 as a negative rune
+func rawByte(b byte) rune {
+	return -1 - rune(b)
+}
+
+// Result holds the digest of normalised input
+type Result struct {
+	Hash *tlsh.TLSH
+	// Applied holds the normalisations that changed the input
+	Applied Normalization
+}
+
+// Hash calculates the TLSH of the normalised input
+func Hash(r io.Reader, opts Options) (*Result, error) {
+	nr := NewReader(r, opts)
+	t, err := tlsh.HashReader(nr)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Hash: t, Applied: nr.Applied()}, nil
+}
+
+// HashFilename calculates the TLSH of the normalised file, the language is
+// guessed from the file extension if none is set
+func HashFilename(filename string, opts Options) (*Result, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if opts.Language == LanguageNone {
+		opts.Language = LanguageFromFilename(filename)
+	}
+	return Hash(f, opts)
+}
+
+// stage is a single normalisation step, it pushes its output to the next stage
+type stage interface {
+	push(c rune)
+	flush()
+}
+
+type sink struct {
+	r *Reader
+}
+
+func (s *sink) push(c rune) {
+	switch {
+	case c < 0:
+		s.r.out = append(s.r.out, byte(-1-c))
+	case c < utf8.RuneSelf:
+		s.r.out = append(s.r.out, byte(c))
+	default:
+		n := utf8.EncodeRune(s.r.buf[:], c)
+		s.r.out = append(s.r.out, s.r.buf[:n]...)
+	}
+}
+
+func (s *sink) flush() {}
+
+type lineEndings struct {
+	next stage
+	r    *Reader
+	cr   bool
+}
+
+func (s *lineEndings) push(c rune) {
+	if s.cr {
+		s.cr = false
+		s.r.applied |= LineEndings
+		s.next.push('\n')
+		if c == '\n' {
+			return
+		}
+	}
+	if c == '\r' {
+		s.cr = true
+		return
+	}
+	s.next.push(c)
+}
+
+func (s *lineEndings) flush() {
+	if s.cr {
+		s.cr = false
+		s.r.applied |= LineEndings
+		s.next.push('\n')
+	}
+	s.next.flush()
+}
+
+type comments struct {
+	next    stage
+	r       *Reader
+	syntax  syntax
+	pending []rune // code that may be the start of a comment
+	quote   rune   // set inside string literals
+	escaped bool
+	end     string // set inside comments
+	tail    []rune // end of the comment read so far
+}
+
+func (s *comments) push(c rune) {
+	switch {
+	case s.end != "":
+		s.inComment(c)
+	case s.quote != 0:
+		s.inString(c)
+	default:
+		s.inCode(c)
+	}
+}
+
+func (s *comments) inString(c rune) {
+	s.next.push(c)
+	switch {
+	case s.escaped:
+		s.escaped = false
+	case c == '\\':
+		s.escaped = true
+	case c == s.quote, c == '\n' && s.quote != '`':
+		s.quote = 0
+	}
+}
+
+func (s *comments) inComment(c rune) {
+	if s.end == "\n" {
+		if c == '\n' {
+			s.end = ""
+			s.next.push(c)
+		}
+		return
+	}
+	s.tail = append(s.tail, c)
+	if len(s.tail) > len(s.end) {
+		s.tail = s.tail[1:]
+	}
+	if string(s.tail) == s.end {
+		s.end = ""
+		s.tail = s.tail[:0]
+	}
+}
+
+func (s *comments) inCode(c rune) {
+	if len(s.pending) == 0 && c > 0 && strings.ContainsRune(s.syntax.quotes, c) {
+		s.next.push(c)
+		s.quote = c
+		return
+	}
+	s.pending = append(s.pending, c)
+	p := string(s.pending)
+	if end, ok := s.start(p); ok {
+		s.r.applied |= Comments
+		s.pending = s.pending[:0]
+		s.end = end
+		return
+	}
+	if s.isStartPrefix(p) {
+		return
+	}
+	// not a comment, emit the first rune and reconsider the rest
+	rest := append([]rune(nil), s.pending[1:]...)
+	s.next.push(s.pending[0])
+	s.pending = s.pending[:0]
+	for _, c := range rest {
+		s.push(c)
+	}
+}
+
+// start returns the end marker of the comment started by p
+func (s *comments) start(p string) (string, bool) {
+	for _, l := range s.syntax.line {
+		if p == l {
+			return "\n", true
+		}
+	}
+	for _, b := range s.syntax.block {
+		if p == b[0] {
+			return b[1], true
+		}
+	}
+	return "", false
+}
+
+func (s *comments) isStartPrefix(p string) bool {
+	for _, l := range s.syntax.line {
+		if strings.HasPrefix(l, p) {
+			return true
+		}
+	}
+	for _, b := range s.syntax.block {
+		if strings.HasPrefix(b[0], p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *comments) flush() {
+	if s.end == "" {
+		for _, c := range s.pending {
+			s.next.push(c)
+		}
+	}
+	s.pending = s.pending[:0]
+	s.next.flush()
+}
+
+// maxSegment bounds the runes buffered by nfc, longer runs of combining
+// marks are normalised in parts
+const maxSegment = 64
+
+// nfc normalises the segments between NFC boundaries
+type nfc struct {
+	next    stage
+	r       *Reader
+	segment []byte
+}
+
+func (s *nfc) push(c rune) {
+	if c < 0 {
+		s.normalize()
+		s.next.push(c)
+		return
+	}
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], c)
+	if norm.NFC.Properties(buf[:n]).BoundaryBefore() || utf8.RuneCount(s.segment) >= maxSegment {
+		s.normalize()
+	}
+	s.segment = append(s.segment, buf[:n]...)
+}
+
+// normalize pushes the buffered segment in NFC
+func (s *nfc) normalize() {
+	if len(s.segment) == 0 {
+		return
+	}
+	out := norm.NFC.Bytes(s.segment)
+	if string(out) != string(s.segment) {
+		s.r.applied |= NFC
+	}
+	for len(out) > 0 {
+		c, size := utf8.DecodeRune(out)
+		s.next.push(c)
+		out = out[size:]
+	}
+	s.segment = s.segment[:0]
+}
+
+func (s *nfc) flush() {
+	s.normalize()
+	s.next.flush()
+}
+
+type caseFold struct {
+	next stage
+	r    *Reader
+}
+
+func (s *caseFold) push(c rune) {
+	if c >= 0 {
+		if l := unicode.ToLower(c); l != c {
+			s.r.applied |= CaseFold
+			c = l
+		}
+	}
+	s.next.push(c)
+}
+
+func (s *caseFold) flush() {
+	s.next.flush()
+}
+
+type whitespace struct {
+	next      stage
+	r         *Reader
+	lineStart bool
+	blanks    int
+	blank     rune
+}
+
+func (s *whitespace) push(c rune) {
+	switch {
+	case c == '\n':
+		if s.blanks > 0 {
+			s.r.applied |= Whitespace
+			s.blanks = 0
+		}
+		if s.lineStart {
+			s.r.applied |= Whitespace
+			return
+		}
+		s.lineStart = true
+		s.next.push(c)
+	case c >= 0 && unicode.IsSpace(c):
+		if s.lineStart {
+			s.r.applied |= Whitespace
+			return
+		}
+		if s.blanks == 0 {
+			s.blank = c
+		}
+		s.blanks++
+	default:
+		if s.blanks > 0 {
+			if s.blanks > 1 || s.blank != ' ' {
+				s.r.applied |= Whitespace
+			}
+			s.blanks = 0
+			s.next.push(' ')
+		}
+		s.lineStart = false
+		s.next.push(c)
+	}
+}
+
+func (s *whitespace) flush() {
+	if s.blanks > 0 {
+		s.r.applied |= Whitespace
+		s.blanks = 0
+	}
+	s.next.flush()
+}
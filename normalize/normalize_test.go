@@ -0,0 +1,128 @@
+package normalize
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+var normalizeTestCases = []struct {
+	in      string
+	opts    Options
+	out     string
+	applied Normalization
+}{
+	{"a\r\nb\rc\n", Options{Normalizations: LineEndings}, "a\nb\nc\n", LineEndings},
+	{"a\nb\n", Options{Normalizations: LineEndings}, "a\nb\n", None},
+	{"  if  x {\t\n\n\treturn\n}  ", Options{Normalizations: Whitespace}, "if x {\nreturn\n}", Whitespace},
+	{"a b\nc\n", Options{Normalizations: Whitespace}, "a b\nc\n", None},
+	{"Hello WORLD", Options{Normalizations: CaseFold}, "hello world", CaseFold},
+	{"e\u0301 \u212b \u1100\u1161\u11a8", Options{Normalizations: NFC}, "\u00e9 \u00c5 \uac01", NFC},
+	{"\u00e9", Options{Normalizations: NFC}, "\u00e9", None},
+	{"a\u0302\u0323", Options{Normalizations: NFC}, "\u1ead", NFC},
+	{"\u1ead", Options{Normalizations: NFC}, "\u1ead", None},
+	{"x = 1 // one\ny = \"//\" /* two\n */ + 2\n", Options{Normalizations: Comments, Language: LanguageC}, "x = 1 \ny = \"//\"  + 2\n", Comments},
+	{"a = '#' # c\n#!/bin\nb\n", Options{Normalizations: Comments, Language: LanguageShell}, "a = '#' \n\nb\n", Comments},
+	{"select 1 -- c\nfrom t /* x */", Options{Normalizations: Comments, Language: LanguageSQL}, "select 1 \nfrom t ", Comments},
+	{"<p><!-- c -->x</p><", Options{Normalizations: Comments, Language: LanguageHTML}, "<p>x</p><", Comments},
+	{"; c\nk=v\n", Options{Normalizations: Comments, Language: LanguageINI}, "\nk=v\n", Comments},
+	{"a // b", Options{Normalizations: Comments}, "a // b", None},
+	{"A\xff\xfeB", Options{Normalizations: All, Language: LanguageC}, "a\xff\xfeb", CaseFold},
+	{
+		"  X = 1 // One\r\n\r\n  Y = 2\r\n",
+		Options{Normalizations: All, Language: LanguageC},
+		"x = 1\ny = 2\n",
+		LineEndings | Comments | CaseFold | Whitespace,
+	},
+}
+
+func TestReader(t *testing.T) {
+	for _, tc := range normalizeTestCases {
+		r := NewReader(strings.NewReader(tc.in), tc.opts)
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(out) != tc.out || r.Applied() != tc.applied {
+			t.Errorf("\n%q with %s: %q (%s) vs. %q (%s)\n", tc.in, tc.opts.Normalizations, out, r.Applied(), tc.out, tc.applied)
+		}
+	}
+}
+
+func TestNFCEquivalence(t *testing.T) {
+	equivalentTestCases := [][]string{
+		{"a\u0323\u0302", "a\u0302\u0323", "\u1ea1\u0302", "\u00e2\u0323", "\u1ead"},
+		{"\u212b", "\u00c5", "A\u030a"},
+		{"q\u0307\u0323x", "q\u0323\u0307x"},
+		{"\u1100\u1161\u11a8", "\uac00\u11a8", "\uac01"},
+	}
+	for _, equivalent := range equivalentTestCases {
+		var first []byte
+		for i, in := range equivalent {
+			out, err := io.ReadAll(NewReader(strings.NewReader(in), Options{Normalizations: NFC}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				first = out
+			} else if !bytes.Equal(out, first) {
+				t.Errorf("\n%q: %q vs. %q of %q\n", in, out, first, equivalent[0])
+			}
+		}
+	}
+}
+
+func TestNormalizationString(t *testing.T) {
+	if s := None.String(); s != "none" {
+		t.Errorf("\nwrong name %s\n", s)
+	}
+	if s := (LineEndings | Whitespace).String(); s != "line-endings,whitespace" {
+		t.Errorf("\nwrong name %s\n", s)
+	}
+}
+
+func TestHash(t *testing.T) {
+	blob, err := os.ReadFile("../tests/test_file_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := bytes.ToUpper(bytes.Replace(blob, []byte("\n"), []byte("  \r\n"), -1))
+
+	opts := Options{Normalizations: LineEndings | CaseFold | Whitespace}
+	a, err := Hash(bytes.NewReader(blob), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Hash(bytes.NewReader(edited), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := a.Hash.Diff(b.Hash); diff != 0 {
+		t.Errorf("\nnormalised hashes differ by %d\n", diff)
+	}
+	if b.Applied != opts.Normalizations {
+		t.Errorf("\nwrong applied normalisations %s\n", b.Applied)
+	}
+
+	if _, err := Hash(strings.NewReader("too short"), opts); err == nil {
+		t.Error("missing error for short input")
+	}
+}
+
+func TestHashFilename(t *testing.T) {
+	if LanguageFromFilename("x/Main.GO") != LanguageC || LanguageFromFilename("x.bin") != LanguageNone {
+		t.Error("wrong language from filename")
+	}
+	res, err := HashFilename("../tests/test_file_1", Options{Normalizations: All})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Applied&Comments != 0 {
+		t.Errorf("\nunexpected comment stripping %s\n", res.Applied)
+	}
+	if _, err := HashFilename("../tests/NON_EXISTENT", Options{}); err == nil {
+		t.Error("missing error for non existent file")
+	}
+}
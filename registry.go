@@ -0,0 +1,114 @@
+package tlsh
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrUnknownAlgorithm is returned by Lookup for unregistered algorithms
+	ErrUnknownAlgorithm = errors.New("unknown similarity hash algorithm")
+	// ErrDigestMismatch is returned when comparing digests of different algorithms
+	ErrDigestMismatch = errors.New("digests of different algorithms cannot be compared")
+)
+
+// Digest is the digest of a similarity hash algorithm
+type Digest interface {
+	String() string
+	Binary() []byte
+	// Distance returns the distance to a digest of the same algorithm,
+	// 0 for identical inputs and growing with their difference
+	Distance(other Digest) (int, error)
+}
+
+// Hasher calculates and parses the digests of a similarity hash algorithm
+type Hasher interface {
+	// Name returns the name the algorithm is registered with
+	Name() string
+	HashBytes(blob []byte) (Digest, error)
+	HashReader(r io.Reader) (Digest, error)
+	// Parse parses the String representation of a digest
+	Parse(s string) (Digest, error)
+}
+
+var _ Digest = &TLSH{}
+
+// Distance returns the distance to another TLSH like Diff
+func (t *TLSH) Distance(other Digest) (int, error) {
+	o, ok := other.(*TLSH)
+	if !ok {
+		return -1, ErrDigestMismatch
+	}
+	return t.Diff(o), nil
+}
+
+// tlshHasher is the Hasher of the TLSH implemented by this package
+type tlshHasher struct {
+	name string
+}
+
+func (h tlshHasher) Name() string {
+	return h.name
+}
+
+func (h tlshHasher) HashBytes(blob []byte) (Digest, error) {
+	return HashBytes(blob)
+}
+
+func (h tlshHasher) HashReader(r io.Reader) (Digest, error) {
+	return HashReader(r)
+}
+
+func (h tlshHasher) Parse(s string) (Digest, error) {
+	return ParseStringToTlsh(s)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Hasher{
+		"tlsh":       tlshHasher{name: "tlsh"},
+		"tlsh-128-1": tlshHasher{name: "tlsh-128-1"},
+		"tlsh-128-3": checksum3Hasher{},
+	}
+)
+
+// Register makes a Hasher available by name. It panics if the name is
+// already registered or h is nil.
+func Register(name string, h Hasher) {
+	if h == nil {
+		panic("tlsh: Register called with a nil Hasher for algorithm " + name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic("tlsh: Register called twice for algorithm " + name)
+	}
+	registry[name] = h
+}
+
+// Lookup returns the Hasher registered by name. TLSH variants are named
+// tlsh-<buckets>-<checksum bytes>, this package registers tlsh-128-1, also
+// named tlsh, and tlsh-128-3.
+func Lookup(name string) (Hasher, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	h, ok := registry[name]
+	if !ok {
+		return nil, ErrUnknownAlgorithm
+	}
+	return h, nil
+}
+
+// Algorithms returns the sorted names of the registered algorithms
+func Algorithms() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
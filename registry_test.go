@@ -0,0 +1,141 @@
+package tlsh
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// fakeDigest is a Digest of another algorithm
+type fakeDigest string
+
+func (d fakeDigest) String() string                     { return string(d) }
+func (d fakeDigest) Binary() []byte                     { return []byte(d) }
+func (d fakeDigest) Distance(other Digest) (int, error) { return 0, nil }
+
+func TestRegistry(t *testing.T) {
+	lookupTestCases := []struct {
+		name string
+		err  error
+	}{
+		{"tlsh", nil},
+		{"tlsh-128-1", nil},
+		{"tlsh-128-3", nil},
+		{"tlsh-256-1", ErrUnknownAlgorithm},
+		{"tlsh-128", ErrUnknownAlgorithm},
+		{"ssdeep", ErrUnknownAlgorithm},
+	}
+	for _, tc := range lookupTestCases {
+		if _, err := Lookup(tc.name); err != tc.err {
+			t.Errorf("\n%s: expected %v, got %v\n", tc.name, tc.err, err)
+		}
+	}
+
+	h, err := Lookup("tlsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := os.ReadFile("tests/test_file_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := h.HashBytes(blob)
+	if err != nil || a.String() != hashTestCases[0].hash {
+		t.Errorf("\nunexpected digest %s (%v)\n", a, err)
+	}
+	b, err := h.HashReader(bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := h.Parse(hashTestCases[1].hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := a.Distance(b); err != nil || d != 0 {
+		t.Errorf("\nexpected distance 0, got %d (%v)\n", d, err)
+	}
+	if d, err := a.Distance(c); err != nil || d != 418 {
+		t.Errorf("\nexpected distance 418, got %d (%v)\n", d, err)
+	}
+	if _, err := a.Distance(fakeDigest("x")); err != ErrDigestMismatch {
+		t.Errorf("\nexpected %v, got %v\n", ErrDigestMismatch, err)
+	}
+
+	Register("fake", tlshHasher{name: "fake"})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "fake")
+		registryMu.Unlock()
+	}()
+	if names := Algorithms(); len(names) != 4 || names[0] != "fake" {
+		t.Errorf("\nunexpected algorithms %v\n", names)
+	}
+	registerTestCases := []struct {
+		name string
+		h    Hasher
+	}{
+		{"tlsh", tlshHasher{}},
+		{"nil", nil},
+	}
+	for _, tc := range registerTestCases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("\n%s: missing panic\n", tc.name)
+				}
+			}()
+			Register(tc.name, tc.h)
+		}()
+	}
+}
+
+func TestChecksum3(t *testing.T) {
+	h, err := Lookup("tlsh-128-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := make([][]byte, 2)
+	for i, filename := range []string{"tests/test_file_1", "tests/test_file_2"} {
+		if blobs[i], err = os.ReadFile(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := h.HashBytes(blobs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the 1 byte checksum and the body are shared with tlsh-128-1
+	if s := a.String(); len(s) != 74 || s[:2] != hashTestCases[0].hash[:2] || s[6:] != hashTestCases[0].hash[2:] {
+		t.Errorf("\nunexpected digest %s for %s\n", s, hashTestCases[0].hash)
+	}
+	b, err := h.Parse(a.String())
+	if err != nil || b.String() != a.String() {
+		t.Fatalf("\ncould not parse %s: %s (%v)\n", a, b, err)
+	}
+	if d, err := a.Distance(b); err != nil || d != 0 {
+		t.Errorf("\nexpected distance 0, got %d (%v)\n", d, err)
+	}
+
+	c, err := h.HashReader(bytes.NewReader(blobs[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := a.Distance(c); err != nil || d != 418 {
+		t.Errorf("\nexpected distance 418, got %d (%v)\n", d, err)
+	}
+	// differing in the extended checksum bytes only
+	e := *b.(*tlsh3)
+	e.checksum[2]++
+	if d, err := a.Distance(&e); err != nil || d != 1 {
+		t.Errorf("\nexpected distance 1, got %d (%v)\n", d, err)
+	}
+	if _, err := a.Distance(c.(*tlsh3).hash); err != ErrDigestMismatch {
+		t.Errorf("\nexpected %v, got %v\n", ErrDigestMismatch, err)
+	}
+	if _, err := h.Parse(hashTestCases[0].hash); err == nil {
+		t.Error("missing error for a tlsh-128-1 digest")
+	}
+	if _, err := h.HashBytes(blobs[0][:49]); err == nil {
+		t.Error("missing error for a short input")
+	}
+}
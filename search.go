@@ -0,0 +1,210 @@
+package tlsh
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// searchBatchSize is the number of digests a worker of SearchStream
+// compares at a time
+const searchBatchSize = 1024
+
+// matchHeap keeps the worst of the best matches found so far on top
+type matchHeap []Match
+
+func (h matchHeap) Len() int { return len(h) }
+func (h matchHeap) Less(i, j int) bool {
+	if h[i].Distance != h[j].Distance {
+		return h[i].Distance > h[j].Distance
+	}
+	return h[i].Index > h[j].Index
+}
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(Match)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
+
+// topK collects the k closest matches within maxDistance
+type topK struct {
+	k           int
+	maxDistance int
+	matches     matchHeap
+}
+
+// bound returns the largest distance still worth computing
+func (t *topK) bound() int {
+	if t.k > 0 && len(t.matches) == t.k {
+		return t.matches[0].Distance
+	}
+	return t.maxDistance
+}
+
+func (t *topK) add(query *TLSH, i int, h *TLSH) {
+	if h == nil {
+		return
+	}
+	d, ok := boundedDiff(query, h, t.bound())
+	if !ok {
+		return
+	}
+	m := Match{Index: i, Distance: d}
+	if t.k <= 0 || len(t.matches) < t.k {
+		heap.Push(&t.matches, m)
+		return
+	}
+	if worst := t.matches[0]; d < worst.Distance || (d == worst.Distance && i < worst.Index) {
+		t.matches[0] = m
+		heap.Fix(&t.matches, 0)
+	}
+}
+
+// merge returns the k best matches of the collectors, sorted
+func merge(collectors []*topK, k int) []Match {
+	var matches []Match
+	for _, c := range collectors {
+		matches = append(matches, c.matches...)
+	}
+	SortMatches(matches)
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// boundedDiff returns the distance of a and b like Diff, unless it is
+// larger than bound
+func boundedDiff(a, b *TLSH, bound int) (int, bool) {
+	d := diffHeader(a, b)
+	if d > bound {
+		return 0, false
+	}
+	for i := 0; i < codeSize; i++ {
+		d += bitPairsDiffTable[a.code[i]][b.code[i]]
+		if d > bound {
+			return 0, false
+		}
+	}
+	return d, true
+}
+
+// diffHeader is the distance of the header components computed by diffTotal
+func diffHeader(a, b *TLSH) int {
+	d := LengthDiff(a.lValue, b.lValue)
+	for _, qDiff := range []int{modDiff(a.q1Ratio, b.q1Ratio, 16), modDiff(a.q2Ratio, b.q2Ratio, 16)} {
+		if qDiff <= 1 {
+			d += qDiff
+		} else {
+			d += (qDiff - 1) * 12
+		}
+	}
+	if a.checksum != b.checksum {
+		d++
+	}
+	return d
+}
+
+// Search returns the k digests of the corpus closest to the query within
+// maxDistance, sorted by distance and index. A k of zero or less returns all
+// digests within maxDistance. The corpus is split across GOMAXPROCS workers
+// and digests whose distance exceeds the best k found so far are abandoned
+// early. Nil digests are skipped.
+func Search(query *TLSH, corpus []*TLSH, k, maxDistance int) []Match {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(corpus)/searchBatchSize+1 {
+		workers = len(corpus)/searchBatchSize + 1
+	}
+	collectors := make([]*topK, workers)
+	var wg sync.WaitGroup
+	for w := range collectors {
+		c := &topK{k: k, maxDistance: maxDistance}
+		collectors[w] = c
+		start, end := w*len(corpus)/workers, (w+1)*len(corpus)/workers
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				c.add(query, i, corpus[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return merge(collectors, k)
+}
+
+// SearchStream is Search over the digests returned by next until it returns
+// io.EOF, so the corpus need not fit in memory. The index of a match is the
+// position of the digest in the stream. Any other error of next stops the
+// search and is returned with the matches found until then.
+func SearchStream(query *TLSH, next func() (*TLSH, error), k, maxDistance int) ([]Match, error) {
+	type batch struct {
+		offset int
+		hashes []*TLSH
+	}
+	batches := make(chan batch)
+	collectors := make([]*topK, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for w := range collectors {
+		c := &topK{k: k, maxDistance: maxDistance}
+		collectors[w] = c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				for i, h := range b.hashes {
+					c.add(query, b.offset+i, h)
+				}
+			}
+		}()
+	}
+
+	var err error
+	b := batch{hashes: make([]*TLSH, 0, searchBatchSize)}
+	for n := 0; ; n++ {
+		var h *TLSH
+		if h, err = next(); err != nil {
+			break
+		}
+		b.hashes = append(b.hashes, h)
+		if len(b.hashes) == searchBatchSize {
+			batches <- b
+			b = batch{offset: n + 1, hashes: make([]*TLSH, 0, searchBatchSize)}
+		}
+	}
+	if len(b.hashes) > 0 {
+		batches <- b
+	}
+	close(batches)
+	wg.Wait()
+	if err == io.EOF {
+		err = nil
+	}
+	return merge(collectors, k), err
+}
+
+// SearchReader is SearchStream over digests read from r, one hex digest per
+// line optionally followed by whitespace and further fields like a path.
+// Empty lines are skipped and do not count as digests.
+func SearchReader(query *TLSH, r io.Reader, k, maxDistance int) ([]Match, error) {
+	scanner := bufio.NewScanner(r)
+	return SearchStream(query, func() (*TLSH, error) {
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			return ParseStringToTlsh(fields[0])
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}, k, maxDistance)
+}
@@ -0,0 +1,118 @@
+package tlsh
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// bruteForce returns the k closest digests within maxDistance
+func bruteForce(query *TLSH, corpus []*TLSH, k, maxDistance int) []Match {
+	var matches []Match
+	for i, h := range corpus {
+		if h == nil {
+			continue
+		}
+		if d := query.Diff(h); d <= maxDistance {
+			matches = append(matches, Match{Index: i, Distance: d})
+		}
+	}
+	SortMatches(matches)
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+func equalMatches(a, b []Match) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSearch(t *testing.T) {
+	corpus := shardedCorpus(t)
+	corpus = append(corpus, nil)
+	for _, q := range []int{0, 15, 45, 85} {
+		for _, k := range []int{0, 1, 5, 1000} {
+			for _, maxDistance := range []int{0, 50, 300, 1 << 20} {
+				expected := bruteForce(corpus[q], corpus, k, maxDistance)
+				if matches := Search(corpus[q], corpus, k, maxDistance); !equalMatches(matches, expected) {
+					t.Errorf("\nk %d, max distance %d: expected %v, got %v\n", k, maxDistance, expected, matches)
+				}
+				i := 0
+				matches, err := SearchStream(corpus[q], func() (*TLSH, error) {
+					if i == len(corpus) {
+						return nil, io.EOF
+					}
+					i++
+					return corpus[i-1], nil
+				}, k, maxDistance)
+				if err != nil || !equalMatches(matches, expected) {
+					t.Errorf("\nstream k %d, max distance %d: expected %v, got %v (%v)\n", k, maxDistance, expected, matches, err)
+				}
+			}
+		}
+	}
+	if matches := Search(corpus[0], nil, 5, 100); len(matches) != 0 {
+		t.Errorf("\nunexpected matches in empty corpus %v\n", matches)
+	}
+}
+
+func TestSearchStreamError(t *testing.T) {
+	corpus := shardedCorpus(t)
+	i := 0
+	failure := errors.New("failure")
+	matches, err := SearchStream(corpus[0], func() (*TLSH, error) {
+		if i == 10 {
+			return nil, failure
+		}
+		i++
+		return corpus[i-1], nil
+	}, 0, 1<<20)
+	if err != failure || len(matches) != 10 {
+		t.Errorf("\nexpected 10 matches and %v, got %d and %v\n", failure, len(matches), err)
+	}
+}
+
+func TestSearchReader(t *testing.T) {
+	var lines []string
+	for _, tc := range hashTestCases[:9] {
+		lines = append(lines, tc.hash+"  "+tc.filename, "")
+	}
+	query, _ := ParseStringToTlsh(hashTestCases[2].hash)
+	matches, err := SearchReader(query, strings.NewReader(strings.Join(lines, "\n")), 2, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corpus []*TLSH
+	for _, tc := range hashTestCases[:9] {
+		h, _ := ParseStringToTlsh(tc.hash)
+		corpus = append(corpus, h)
+	}
+	expected := bruteForce(query, corpus, 2, 400)
+	if len(expected) != 2 || expected[0].Index != 2 {
+		t.Fatalf("\nunexpected brute force matches %v\n", expected)
+	}
+	if !equalMatches(matches, expected) {
+		t.Errorf("\nexpected %v, got %v\n", expected, matches)
+	}
+	if _, err := SearchReader(query, strings.NewReader("zz\n"), 2, 400); err == nil {
+		t.Error("missing error for invalid digest")
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	corpus := shardedCorpus(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		Search(corpus[n%len(corpus)], corpus, 10, 100)
+	}
+}
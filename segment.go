@@ -0,0 +1,220 @@
+package tlsh
+
+import (
+	"errors"
+	"io"
+)
+
+// Segment is the digest of a region of the input
+type Segment struct {
+	// Offset of the region in the input
+	Offset int64
+	// Length of the region
+	Length int64
+	// Hash is nil if the region could not be hashed, see Err
+	Hash *TLSH
+	// Err is set if the region could not be hashed, e.g. it is too small
+	Err error
+}
+
+// SegmentOptions configures HashSegments
+type SegmentOptions struct {
+	// Size of the segments in bytes
+	Size int64
+	// Step between the start of two segments, Size for adjacent segments and
+	// less than Size for overlapping sliding windows
+	Step int64
+}
+
+// segmentWindow is a segment being hashed
+type segmentWindow struct {
+	offset int64
+	state  *chunkState
+}
+
+// HashSegments calculates the TLSH of fixed-size segments of the input, read
+// once. The last segment covers the remaining input and may be shorter.
+func HashSegments(r io.Reader, opts SegmentOptions) ([]Segment, error) {
+	if opts.Size <= 0 || opts.Step <= 0 || opts.Step > opts.Size {
+		return nil, errors.New("segment size and step must be positive and step not larger than size")
+	}
+
+	var (
+		segments  []Segment
+		active    []segmentWindow
+		free      []*chunkState
+		nextStart int64
+		base      int64
+	)
+	buf := readBuffers.Get().(*[readBufferSize]byte)
+	defer readBuffers.Put(buf)
+
+	for {
+		n, err := r.Read(buf[:])
+		for pos := 0; pos < n; {
+			// advance to the next segment start or end
+			next := base + int64(n)
+			if nextStart < next {
+				next = nextStart
+			}
+			for _, w := range active {
+				if end := w.offset + opts.Size; end < next {
+					next = end
+				}
+			}
+			p := buf[pos : next-base]
+			for _, w := range active {
+				w.state.update(p)
+			}
+			pos = int(next - base)
+
+			if len(active) > 0 && active[0].offset+opts.Size == next {
+				segments = append(segments, segment(active[0], opts.Size))
+				free = append(free, active[0].state)
+				active = active[1:]
+			}
+			if nextStart == next && pos < n {
+				var s *chunkState
+				if len(free) > 0 {
+					s, free = free[len(free)-1], free[:len(free)-1]
+				} else {
+					s = &chunkState{}
+				}
+				s.reset()
+				active = append(active, segmentWindow{offset: nextStart, state: s})
+				nextStart += opts.Step
+			}
+		}
+		base += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return segments, err
+		}
+	}
+
+	// the oldest unfinished segment covers the rest of the input
+	if len(active) > 0 && (len(segments) == 0 || segments[len(segments)-1].Offset+opts.Size < base) {
+		segments = append(segments, segment(active[0], base-active[0].offset))
+	}
+	return segments, nil
+}
+
+func segment(w segmentWindow, length int64) Segment {
+	s := Segment{Offset: w.offset, Length: length}
+	t, err := digest(w.state.buckets, w.state.checksum, w.state.fileSize)
+	if err != nil {
+		s.Err = err
+		return s
+	}
+	s.Hash = t
+	return s
+}
+
+// SegmentMatch pairs a segment of one input with a segment of another
+type SegmentMatch struct {
+	// A is the index of the segment in the first sequence
+	A int
+	// B is the index of the segment in the second sequence
+	B int
+	// Distance between the segments
+	Distance int
+}
+
+// AlignSegments returns the order preserving alignment of the segments of
+// two inputs with the most and closest segment pairs within threshold. It
+// compares every pair of segments, so it takes O(len(a)*len(b)) time.
+func AlignSegments(a, b []Segment, threshold int) []SegmentMatch {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	// score[i][j] is the best alignment of a[:i] and b[:j]
+	score := make([][]int, len(a)+1)
+	for i := range score {
+		score[i] = make([]int, len(b)+1)
+	}
+	dist := func(i, j int) int {
+		if a[i].Hash == nil || b[j].Hash == nil {
+			return -1
+		}
+		if d := a[i].Hash.Diff(b[j].Hash); d <= threshold {
+			return d
+		}
+		return -1
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			best := score[i-1][j]
+			if score[i][j-1] > best {
+				best = score[i][j-1]
+			}
+			if d := dist(i-1, j-1); d >= 0 {
+				if s := score[i-1][j-1] + threshold - d + 1; s > best {
+					best = s
+				}
+			}
+			score[i][j] = best
+		}
+	}
+
+	var matches []SegmentMatch
+	for i, j := len(a), len(b); i > 0 && j > 0; {
+		switch {
+		case score[i][j] == score[i-1][j]:
+			i--
+		case score[i][j] == score[i][j-1]:
+			j--
+		default:
+			matches = append(matches, SegmentMatch{A: i - 1, B: j - 1, Distance: dist(i-1, j-1)})
+			i--
+			j--
+		}
+	}
+	for l, r := 0, len(matches)-1; l < r; l, r = l+1, r-1 {
+		matches[l], matches[r] = matches[r], matches[l]
+	}
+	return matches
+}
+
+// Region is a region of one input matching a region of another
+type Region struct {
+	AOffset int64
+	ALength int64
+	BOffset int64
+	BLength int64
+	// Segments is the number of matched segments in the region
+	Segments int
+	// MaxDistance is the largest distance of the matched segments
+	MaxDistance int
+}
+
+// MatchedRegions merges aligned segments that are adjacent or overlapping
+// in both inputs into regions
+func MatchedRegions(a, b []Segment, matches []SegmentMatch) []Region {
+	var regions []Region
+	for _, m := range matches {
+		sa, sb := a[m.A], b[m.B]
+		if len(regions) > 0 {
+			r := &regions[len(regions)-1]
+			if sa.Offset <= r.AOffset+r.ALength && sb.Offset <= r.BOffset+r.BLength {
+				r.ALength = sa.Offset + sa.Length - r.AOffset
+				r.BLength = sb.Offset + sb.Length - r.BOffset
+				r.Segments++
+				if m.Distance > r.MaxDistance {
+					r.MaxDistance = m.Distance
+				}
+				continue
+			}
+		}
+		regions = append(regions, Region{
+			AOffset:     sa.Offset,
+			ALength:     sa.Length,
+			BOffset:     sb.Offset,
+			BLength:     sb.Length,
+			Segments:    1,
+			MaxDistance: m.Distance,
+		})
+	}
+	return regions
+}
@@ -0,0 +1,97 @@
+package tlsh
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHashSegments(t *testing.T) {
+	blob, err := os.ReadFile("tests/test_file_9_tinyssl.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segmentTestCases := []SegmentOptions{
+		{Size: 4096, Step: 4096},
+		{Size: 4096, Step: 1024},
+		{Size: 10000, Step: 3333},
+		{Size: 64, Step: 64},
+	}
+	for _, opts := range segmentTestCases {
+		segments, err := HashSegments(iotest.HalfReader(bytes.NewReader(blob)), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, s := range segments {
+			if s.Offset != int64(i)*opts.Step {
+				t.Errorf("\n%+v: segment %d at offset %d\n", opts, i, s.Offset)
+			}
+			expected, expectedErr := HashBytes(blob[s.Offset : s.Offset+s.Length])
+			if (s.Err == nil) != (expectedErr == nil) || (s.Hash != nil && s.Hash.String() != expected.String()) {
+				t.Errorf("\n%+v: segment %d %s (%v) vs. %s (%v)\n", opts, i, s.Hash, s.Err, expected, expectedErr)
+			}
+		}
+		last := segments[len(segments)-1]
+		if last.Offset+last.Length != int64(len(blob)) {
+			t.Errorf("\n%+v: segments end at %d instead of %d\n", opts, last.Offset+last.Length, len(blob))
+		}
+	}
+
+	for _, opts := range []SegmentOptions{{Size: 0, Step: 1}, {Size: 10, Step: 0}, {Size: 10, Step: 11}} {
+		if _, err := HashSegments(bytes.NewReader(blob), opts); err == nil {
+			t.Errorf("\nmissing error for %+v\n", opts)
+		}
+	}
+}
+
+func TestAlignSegments(t *testing.T) {
+	exe, err := os.ReadFile("tests/test_file_9_tinyssl.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	png, err := os.ReadFile("tests/test_file_8_lena.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b embeds a part of a behind unrelated data
+	a := exe
+	b := append(append([]byte(nil), png[:8192]...), exe[16384:57344]...)
+
+	sa, _ := HashSegments(bytes.NewReader(a), SegmentOptions{Size: 4096, Step: 1024})
+	sb, _ := HashSegments(bytes.NewReader(b), SegmentOptions{Size: 4096, Step: 4096})
+	matches := AlignSegments(sa, sb, 30)
+	if len(matches) == 0 {
+		t.Fatal("no matching segments found")
+	}
+	for _, m := range matches {
+		if sb[m.B].Offset < 8192 {
+			t.Errorf("\nunrelated segment %+v matched %+v\n", sb[m.B], sa[m.A])
+		}
+		if sa[m.A].Offset-16384 == sb[m.B].Offset-8192 && m.Distance != 0 {
+			t.Errorf("\nidentical segments %+v and %+v have distance %d\n", sa[m.A], sb[m.B], m.Distance)
+		}
+	}
+
+	regions := MatchedRegions(sa, sb, matches)
+	if len(regions) == 0 {
+		t.Fatal("no matching regions found")
+	}
+	r := regions[0]
+	if r.BOffset != 8192 || r.AOffset != 16384 || r.Segments < 5 {
+		t.Errorf("\nunexpected region %+v\n", r)
+	}
+
+	if AlignSegments(nil, sb, 30) != nil {
+		t.Error("unexpected matches for empty segments")
+	}
+}
+
+func BenchmarkHashSegments(b *testing.B) {
+	blob, _ := os.ReadFile("tests/test_file_9_tinyssl.exe")
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		HashSegments(bytes.NewReader(blob), SegmentOptions{Size: 4096, Step: 1024})
+	}
+}
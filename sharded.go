@@ -0,0 +1,183 @@
+package tlsh
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedIndex is a digest index safe for concurrent use. Digests are
+// sharded by their lValue so that writers to different shards do not block
+// each other and queries skip shards whose length difference alone exceeds
+// the threshold. Queries never block and see a consistent snapshot of the
+// index: every insert or removal completed before the query started and
+// none started after.
+type ShardedIndex struct {
+	// locks serialise the writers of each shard
+	locks []sync.Mutex
+	// root holds the current *indexRoot, replaced on every write
+	root atomic.Value
+	// shardOf maps ids to their shard
+	shardOf sync.Map
+	nextID  int64
+}
+
+// indexRoot is an immutable view of all shards
+type indexRoot struct {
+	shards [][]indexEntry
+	size   int
+}
+
+type indexEntry struct {
+	id   int
+	hash *TLSH
+}
+
+// NewShardedIndex returns an empty index with between 1 and 256 shards
+func NewShardedIndex(shards int) (*ShardedIndex, error) {
+	if shards < 1 || shards > 256 {
+		return nil, errors.New("shards must be between 1 and 256")
+	}
+	s := &ShardedIndex{locks: make([]sync.Mutex, shards)}
+	s.root.Store(&indexRoot{shards: make([][]indexEntry, shards)})
+	return s, nil
+}
+
+// shard returns the shard of the lValue, shards cover adjacent lValues
+func (s *ShardedIndex) shard(l byte) int {
+	return int(l) * len(s.locks) / 256
+}
+
+// update replaces the entries of a shard while holding its lock, retrying
+// until no writer of another shard replaced the root in between
+func (s *ShardedIndex) update(shard int, entries []indexEntry, delta int) {
+	for {
+		old := s.root.Load().(*indexRoot)
+		root := &indexRoot{
+			shards: make([][]indexEntry, len(old.shards)),
+			size:   old.size + delta,
+		}
+		copy(root.shards, old.shards)
+		root.shards[shard] = entries
+		if s.root.CompareAndSwap(old, root) {
+			return
+		}
+	}
+}
+
+// Insert adds a digest to the index and returns its id. Ids are never reused.
+func (s *ShardedIndex) Insert(t *TLSH) int {
+	id := int(atomic.AddInt64(&s.nextID, 1) - 1)
+	shard := s.shard(t.lValue)
+	s.shardOf.Store(id, shard)
+
+	s.locks[shard].Lock()
+	defer s.locks[shard].Unlock()
+	// appending is safe, snapshots never read beyond their length
+	entries := s.root.Load().(*indexRoot).shards[shard]
+	s.update(shard, append(entries, indexEntry{id: id, hash: t}), 1)
+	return id
+}
+
+// Remove removes the digest with the id from the index and reports whether
+// it was present. It copies the shard of the digest.
+func (s *ShardedIndex) Remove(id int) bool {
+	v, ok := s.shardOf.Load(id)
+	if !ok {
+		return false
+	}
+	shard := v.(int)
+
+	s.locks[shard].Lock()
+	defer s.locks[shard].Unlock()
+	entries := s.root.Load().(*indexRoot).shards[shard]
+	for i, e := range entries {
+		if e.id != id {
+			continue
+		}
+		kept := make([]indexEntry, 0, len(entries)-1)
+		kept = append(append(kept, entries[:i]...), entries[i+1:]...)
+		s.update(shard, kept, -1)
+		s.shardOf.Delete(id)
+		return true
+	}
+	return false
+}
+
+// Snapshot returns a consistent read-only view of the current index
+func (s *ShardedIndex) Snapshot() *IndexSnapshot {
+	return &IndexSnapshot{root: s.root.Load().(*indexRoot), index: s}
+}
+
+// Len returns the number of digests in the index
+func (s *ShardedIndex) Len() int {
+	return s.Snapshot().Len()
+}
+
+// Query returns the digests within threshold of t, sorted by distance, with
+// their id as Index
+func (s *ShardedIndex) Query(t *TLSH, threshold int) []Match {
+	return s.Snapshot().Query(t, threshold)
+}
+
+// IndexSnapshot is a read-only view of a ShardedIndex unaffected by later
+// writes
+type IndexSnapshot struct {
+	root  *indexRoot
+	index *ShardedIndex
+}
+
+// Len returns the number of digests in the snapshot
+func (v *IndexSnapshot) Len() int {
+	return v.root.size
+}
+
+// Hash returns the digest with the id and whether it is in the snapshot
+func (v *IndexSnapshot) Hash(id int) (*TLSH, bool) {
+	shard, ok := v.index.shardOf.Load(id)
+	if !ok {
+		// removed after the snapshot was taken, search all shards
+		shard = -1
+	}
+	for s, entries := range v.root.shards {
+		if shard != -1 && s != shard.(int) {
+			continue
+		}
+		for _, e := range entries {
+			if e.id == id {
+				return e.hash, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Query returns the digests within threshold of t, sorted by distance, with
+// their id as Index
+func (v *IndexSnapshot) Query(t *TLSH, threshold int) []Match {
+	// minimum length difference to every shard
+	minDiff := make([]int, len(v.root.shards))
+	for i := range minDiff {
+		minDiff[i] = -1
+	}
+	for l := 0; l < 256; l++ {
+		shard := v.index.shard(byte(l))
+		if d := LengthDiff(t.lValue, byte(l)); minDiff[shard] < 0 || d < minDiff[shard] {
+			minDiff[shard] = d
+		}
+	}
+
+	var matches []Match
+	for shard, entries := range v.root.shards {
+		if minDiff[shard] > threshold {
+			continue
+		}
+		for _, e := range entries {
+			if d := t.Diff(e.hash); d <= threshold {
+				matches = append(matches, Match{Index: e.id, Distance: d})
+			}
+		}
+	}
+	SortMatches(matches)
+	return matches
+}
@@ -0,0 +1,189 @@
+package tlsh
+
+import (
+	"sync"
+	"testing"
+)
+
+// shardedCorpus returns mutated digests of test files of different lengths
+func shardedCorpus(tb testing.TB) []*TLSH {
+	var corpus []*TLSH
+	for _, tc := range hashTestCases[:9] {
+		corpus = append(corpus, mutatedHashes(tb, tc.filename, 10, 10)...)
+	}
+	return corpus
+}
+
+func TestShardedIndex(t *testing.T) {
+	if _, err := NewShardedIndex(0); err == nil {
+		t.Error("missing error for zero shards")
+	}
+	corpus := shardedCorpus(t)
+	for _, shards := range []int{1, 16, 256} {
+		s, err := NewShardedIndex(shards)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, h := range corpus {
+			if id := s.Insert(h); id != i {
+				t.Fatalf("\nexpected id %d, got %d\n", i, id)
+			}
+		}
+		if s.Len() != len(corpus) {
+			t.Errorf("\nexpected %d digests, got %d\n", len(corpus), s.Len())
+		}
+		for _, q := range []int{0, 15, 45, 85} {
+			matches := s.Query(corpus[q], 100)
+			var expected []Match
+			for i, h := range corpus {
+				if d := corpus[q].Diff(h); d <= 100 {
+					expected = append(expected, Match{Index: i, Distance: d})
+				}
+			}
+			SortMatches(expected)
+			if len(matches) != len(expected) {
+				t.Fatalf("\n%d shards: expected %d matches, got %d\n", shards, len(expected), len(matches))
+			}
+			for i := range matches {
+				if matches[i] != expected[i] {
+					t.Errorf("\n%d shards: expected %+v, got %+v\n", shards, expected[i], matches[i])
+				}
+			}
+		}
+
+		snapshot := s.Snapshot()
+		if !s.Remove(3) || s.Remove(3) || s.Remove(len(corpus)) {
+			t.Error("unexpected result of Remove")
+		}
+		if _, ok := s.Snapshot().Hash(3); ok {
+			t.Error("removed digest still in the index")
+		}
+		if h, ok := snapshot.Hash(3); !ok || h != corpus[3] || snapshot.Len() != len(corpus) {
+			t.Error("removal changed an earlier snapshot")
+		}
+		for _, m := range s.Query(corpus[3], 0) {
+			if m.Index == 3 {
+				t.Error("query found removed digest")
+			}
+		}
+	}
+}
+
+func TestShardedIndexConcurrent(t *testing.T) {
+	corpus := shardedCorpus(t)
+	s, err := NewShardedIndex(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ids of the digests inserted by the sequential writer, in order
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, h := range corpus {
+			id := s.Insert(h)
+			mu.Lock()
+			order = append(order, id)
+			mu.Unlock()
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				v := s.Snapshot()
+				seen := map[int]bool{}
+				for _, m := range v.Query(corpus[0], 1<<20) {
+					seen[m.Index] = true
+				}
+				if len(seen) != v.Len() {
+					t.Errorf("\nsnapshot of %d digests returned %d\n", v.Len(), len(seen))
+				}
+				// inserts are sequential, so every snapshot holds a prefix of them
+				mu.Lock()
+				ids := append([]int(nil), order...)
+				mu.Unlock()
+				for k := 1; k < len(ids); k++ {
+					if seen[ids[k]] && !seen[ids[k-1]] {
+						t.Errorf("\nsnapshot holds id %d but not the earlier %d\n", ids[k], ids[k-1])
+						return
+					}
+				}
+			}
+		}()
+	}
+	// concurrent writers of other digests, removed again
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(corpus); i += 4 {
+				id := s.Insert(corpus[i])
+				if !s.Remove(id) {
+					t.Errorf("\ncould not remove %d\n", id)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if s.Len() != len(corpus) {
+		t.Errorf("\nexpected %d digests, got %d\n", len(corpus), s.Len())
+	}
+}
+
+func BenchmarkShardedIndexMixed(b *testing.B) {
+	corpus := shardedCorpus(b)
+	s, _ := NewShardedIndex(64)
+	for _, h := range corpus {
+		s.Insert(h)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			h := corpus[i%len(corpus)]
+			if i%10 == 0 {
+				s.Remove(s.Insert(h))
+			} else {
+				s.Query(h, 70)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkShardedIndexInsert(b *testing.B) {
+	corpus := shardedCorpus(b)
+	s, _ := NewShardedIndex(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			s.Insert(corpus[i%len(corpus)])
+			i++
+		}
+	})
+}
+
+func BenchmarkShardedIndexQuery(b *testing.B) {
+	corpus := shardedCorpus(b)
+	s, _ := NewShardedIndex(64)
+	for _, h := range corpus {
+		s.Insert(h)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			s.Query(corpus[i%len(corpus)], 70)
+			i++
+		}
+	})
+}
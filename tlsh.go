@@ -16,12 +16,12 @@ package tlsh
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/hex"
 	"errors"
 	"io"
 	"math"
 	"os"
+	"sync"
 )
 
 const (
@@ -88,6 +88,9 @@ func ParseStringToTlsh(hashString string) (*TLSH, error) {
 	if err != nil {
 		return &TLSH{}, err
 	}
+	if len(hashByte) != codeSize+3 {
+		return &TLSH{}, errors.New("invalid hash length")
+	}
 	chechsum := swapByte(hashByte[0])
 	lValue := swapByte(hashByte[1])
 	qRatio := hashByte[2]
@@ -97,6 +100,17 @@ func ParseStringToTlsh(hashString string) (*TLSH, error) {
 	return new(chechsum, lValue, q1Ratio, q2Ratio, qRatio, code, chunkState{}), nil
 }
 
+// ParseBinaryToTlsh parses the binary representation of the hash as returned by Binary
+func ParseBinaryToTlsh(hashByte []byte) (*TLSH, error) {
+	var code [codeSize]byte
+	if len(hashByte) != codeSize+3 {
+		return &TLSH{}, errors.New("invalid binary hash length")
+	}
+	qRatio := hashByte[2]
+	copy(code[:], hashByte[3:])
+	return new(swapByte(hashByte[0]), swapByte(hashByte[1]), (qRatio>>4)&0xF, qRatio&0xF, qRatio, code, chunkState{}), nil
+}
+
 func quartilePoints(buckets [numBuckets]uint) (q1, q2, q3 uint) {
 	var spl, spr uint
 	p1 := uint(effBuckets/4 - 1)
@@ -299,44 +313,104 @@ func (s *chunkState) process() {
 
 var salt = [6]byte{2, 3, 5, 7, 11, 13}
 
-func fillBuckets(r FuzzyReader) ([numBuckets]uint, byte, int, error) {
-	state := chunkState{}
-	state.buckets = [numBuckets]uint{}
-	state.chunkSlice = make([]byte, windowLength)
-	state.chunk = [windowLength]byte{}
-	state.fileSize = 0
-	state.checksum = byte(0)
+// reset prepares the state for a new input
+func (s *chunkState) reset() {
+	s.buckets = [numBuckets]uint{}
+	s.chunk = [windowLength]byte{}
+	s.chunkSlice = s.chunkSlice[:0]
+	s.fileSize = 0
+	s.checksum = 0
+	if s.chunk3 == nil {
+		s.chunk3 = &[3]byte{}
+	}
+}
 
-	n, err := r.Read(state.chunkSlice)
-	if err != nil {
-		return [numBuckets]uint{}, 0, 0, err
+// update adds p to the buckets, the first window is processed once it is complete
+func (s *chunkState) update(p []byte) {
+	s.fileSize += len(p)
+	if len(s.chunkSlice) < windowLength {
+		missing := windowLength - len(s.chunkSlice)
+		if len(p) < missing {
+			s.chunkSlice = append(s.chunkSlice, p...)
+			return
+		}
+		s.chunkSlice = append(s.chunkSlice, p[0:missing]...)
+		p = p[missing:]
+		copy(s.chunk[:], s.chunkSlice[0:5])
+		s.chunk = reverse(s.chunk)
+		s.process()
+	}
+
+	for _, b := range p {
+		s.chunk[0] = b
+		s.process()
 	}
-	copy(state.chunk[:], state.chunkSlice[0:5])
-	state.chunk = reverse(state.chunk)
-	state.fileSize += n
+}
+
+// readBufferSize is the size of the chunks read from readers
+const readBufferSize = 32 * 1024
 
-	state.chunk3 = &[3]byte{}
+var readBuffers = sync.Pool{
+	New: func() interface{} {
+		return &[readBufferSize]byte{}
+	},
+}
+
+// fillStream fills the buckets from r until EOF, on error the state holds
+// the buckets of the input read so far
+func (s *chunkState) fillStream(r io.Reader) error {
+	buf := readBuffers.Get().(*[readBufferSize]byte)
+	defer readBuffers.Put(buf)
 
 	for {
-		state.process()
-		state.chunk[0], err = r.ReadByte()
-		if err != nil {
-			if err != io.EOF {
-				return [numBuckets]uint{}, 0, 0, err
+		n, err := r.Read(buf[:])
+		s.update(buf[:n])
+		if err == io.EOF {
+			if s.fileSize == 0 {
+				return io.EOF
 			}
-			break
+			return nil
+		}
+		if err != nil {
+			return err
 		}
-		state.fileSize++
+	}
+}
+
+// hashBytes resets the state and calculates the TLSH for blob
+func (s *chunkState) hashBytes(blob []byte) (*TLSH, error) {
+	s.reset()
+	if len(blob) == 0 {
+		return &TLSH{}, io.EOF
+	}
+	s.update(blob)
+	t, err := digest(s.buckets, s.checksum, s.fileSize)
+	if err != nil {
+		return &TLSH{state: t.state}, err
+	}
+	return t, nil
+}
+
+func fillBuckets(r io.Reader) ([numBuckets]uint, byte, int, error) {
+	state := chunkState{}
+	state.reset()
+	if err := state.fillStream(r); err != nil {
+		return [numBuckets]uint{}, 0, 0, err
 	}
 	return state.buckets, state.checksum, state.fileSize, nil
 }
 
 // hashCalculate calculate TLSH
-func hashCalculate(r FuzzyReader) (*TLSH, error) {
+func hashCalculate(r io.Reader) (*TLSH, error) {
 	buckets, checksum, fileSize, err := fillBuckets(r)
 	if err != nil {
 		return &TLSH{}, err
 	}
+	return digest(buckets, checksum, fileSize)
+}
+
+// digest calculates the TLSH from the filled buckets
+func digest(buckets [numBuckets]uint, checksum byte, fileSize int) (*TLSH, error) {
 	if fileSize < 50 {
 		return &TLSH{
 			state: chunkState{
@@ -373,14 +447,15 @@ func hashCalculate(r FuzzyReader) (*TLSH, error) {
 	return t, nil
 }
 
-// FuzzyReader interface
+// FuzzyReader interface, any io.Reader can be hashed by HashReader
 type FuzzyReader interface {
 	io.Reader
 	io.ByteReader
 }
 
-// HashReader calculates the TLSH for the input reader
-func HashReader(r FuzzyReader) (*TLSH, error) {
+// HashReader calculates the TLSH for the input reader. The input is read in
+// large chunks, so r does not need to be buffered.
+func HashReader(r io.Reader) (*TLSH, error) {
 	t, err := hashCalculate(r)
 	if err != nil {
 		return &TLSH{state: t.state}, err
@@ -388,10 +463,15 @@ func HashReader(r FuzzyReader) (*TLSH, error) {
 	return t, err
 }
 
+// HashReaderAt calculates the TLSH for n bytes of the input starting at offset off
+func HashReaderAt(r io.ReaderAt, off, n int64) (*TLSH, error) {
+	return HashReader(io.NewSectionReader(r, off, n))
+}
+
 // HashBytes calculates the TLSH for the input byte slice
 func HashBytes(blob []byte) (*TLSH, error) {
-	r := bytes.NewReader(blob)
-	return HashReader(r)
+	s := chunkState{}
+	return s.hashBytes(blob)
 }
 
 // HashFilename calculates the TLSH for the input file
@@ -402,8 +482,7 @@ func HashFilename(filename string) (*TLSH, error) {
 	}
 	defer f.Close()
 
-	r := bufio.NewReader(f)
-	return HashReader(r)
+	return HashReader(f)
 }
 
 // Diff current hash with other hash
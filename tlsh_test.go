@@ -2,9 +2,11 @@ package tlsh
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"os"
 	"testing"
+	"testing/iotest"
 )
 
 var (
@@ -71,6 +73,46 @@ func TestHashBytes(t *testing.T) {
 	}
 }
 
+func TestHashReader(t *testing.T) {
+	for _, tc := range hashTestCases {
+		f, err := os.Open(tc.filename)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		blob, _ := io.ReadAll(f)
+		readers := []io.Reader{
+			iotest.OneByteReader(bytes.NewReader(blob)),
+			iotest.HalfReader(bytes.NewReader(blob)),
+			iotest.DataErrReader(bytes.NewReader(blob)),
+		}
+		for _, r := range readers {
+			if out, _ := HashReader(r); out.String() != tc.hash {
+				t.Errorf("\nfilename: %s\n%s\n%s - doesn't match real hash\n", tc.filename, tc.hash, out)
+			}
+		}
+	}
+
+	if _, err := HashReader(iotest.ErrReader(io.ErrUnexpectedEOF)); err != io.ErrUnexpectedEOF {
+		t.Errorf("\nexpected %v, got %v\n", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestHashReaderAt(t *testing.T) {
+	f, err := os.Open("tests/test_file_9_tinyssl.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	blob, _ := io.ReadAll(f)
+	expected, _ := HashBytes(blob[1024 : 1024+69632])
+	if out, err := HashReaderAt(f, 1024, 69632); err != nil || out.String() != expected.String() {
+		t.Errorf("\n%s\n%s - doesn't match section hash (%v)\n", expected, out, err)
+	}
+}
+
 func TestDiff(t *testing.T) {
 	for _, tc := range diffTestCases {
 		if diff, err := DiffFilenames(tc.filenameA, tc.filenameB); diff != tc.diff {
@@ -95,6 +137,33 @@ func TestParseStringToTlsh(t *testing.T) {
 	}
 }
 
+func TestParseStringToTlshInvalid(t *testing.T) {
+	for _, s := range []string{"", "8ed0", "zz", hashTestCases[0].hash + "00"} {
+		if _, err := ParseStringToTlsh(s); err == nil {
+			t.Errorf("\nmissing error for invalid hash %q\n", s)
+		}
+	}
+}
+
+func TestParseBinaryToTlsh(t *testing.T) {
+	for _, tc := range hashTestCases {
+		h, err := ParseStringToTlsh(tc.hash)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if hash, err := ParseBinaryToTlsh(h.Binary()); err != nil || hash.String() != tc.hash || hash.Diff(h) != 0 {
+			if err != nil {
+				t.Error(err)
+			}
+			t.Errorf("\noriginal and parsed tlsh have different hash %s vs. %s\n", tc.hash, hash.String())
+		}
+	}
+	if _, err := ParseBinaryToTlsh([]byte{1, 2, 3}); err == nil {
+		t.Error("missing error for short binary hash")
+	}
+}
+
 func BenchmarkPearson(b *testing.B) {
 	var salt = byte(0)
 	var keys = [3]byte{1, 3, 7}